@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/xxlixin1993/LiLGo/configure"
 	"github.com/xxlixin1993/LiLGo/graceful"
+	"github.com/xxlixin1993/LiLGo/lifecycle"
 	"github.com/xxlixin1993/LiLGo/logging"
 	"github.com/xxlixin1993/LiLGo/server"
 	"os"
-	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
+	"time"
 )
 
 const (
@@ -28,6 +32,8 @@ func initFrame() {
 	runMode := flag.String("m", "local", "Use -m <config mode>")
 	configFile := flag.String("c", "./app.ini", "use -c <config file>")
 	version := flag.Bool("v", false, "Use -v <current version>")
+	var overrides overrideFlags
+	flag.Var(&overrides, "set", "Use -set <key=value> to override the configure, repeatable")
 	flag.Parse()
 
 	// Show version
@@ -39,28 +45,99 @@ func initFrame() {
 	// Initialize exitList
 	graceful.InitExitList()
 
-	// Initialize configure
-	configErr := configure.InitConfig(*configFile, *runMode)
-	if configErr != nil {
-		fmt.Printf("Initialize Configure error : %s", configErr)
-		os.Exit(configure.InitConfigError)
+	// Modules are started in order and stopped in reverse
+	lc := lifecycle.New()
+	configModule := configure.NewModule(*configFile, *runMode, overrides...)
+	configModule.ReloadHandler = logReload
+	lc.Register(configModule)
+	lc.Register(logging.NewModule(), configure.ConfigModuleName)
+	lc.Register(&serverModule{}, configure.ConfigModuleName, logging.LogModuleName)
+
+	if err := lc.Start(context.Background()); err != nil {
+		fmt.Printf("Initialize error : %s\n", err)
+		os.Exit(startErrorCode(err))
 	}
+	if err := lc.RegisterExit(graceful.GetExitList()); err != nil {
+		logging.ErrorF("register exit error : %s", err)
+	}
+
+	// Time limit of every module on exit
+	moduleTimeout := configure.DefaultDuration("app.module_stop_timeout", 0)
+	graceful.GetExitList().SetModuleTimeout(moduleTimeout)
+
+	// Initialize signal handlers
+	initSignal()
 
-	// Initialize log
-	logErr := logging.InitLog()
-	if logErr != nil {
-		fmt.Printf("Initialize log error : %s", logErr)
-		os.Exit(configure.InitLogError)
+	// Started by a graceful restart, the old process can stop now
+	if err := graceful.NotifyParent(); err != nil {
+		logging.Warning(err)
 	}
 
-	// TODO just test
-	eh := server.NewEasyHandler()
-	eh.GET("/", hello)
-	go eh.StartHTTPServer()
+	for _, key := range configure.Overridden() {
+		logging.TraceF("configure %s from %s", key, configure.Source(key))
+	}
 
 	logging.Trace("Initialized frame")
 }
 
+// Repeated -set key=value flags
+type overrideFlags []string
+
+func (of *overrideFlags) String() string {
+	return strings.Join(*of, ",")
+}
+
+func (of *overrideFlags) Set(kv string) error {
+	if _, _, err := configure.ParseOverride(kv); err != nil {
+		return err
+	}
+	*of = append(*of, kv)
+	return nil
+}
+
+// Starts the server of server.support, which is known once the configuration is loaded
+type serverModule struct {
+	lifecycle.Module
+}
+
+func (sm *serverModule) GetModuleName() string {
+	return "serverModule"
+}
+
+func (sm *serverModule) GetStopStage() int {
+	return graceful.StageServer
+}
+
+func (sm *serverModule) Start(ctx context.Context) error {
+	// TODO just test
+	switch configure.DefaultString("server.support", server.SupportHTTP) {
+	case server.SupportTCP:
+		ts := server.NewTCPServer()
+		ts.Handle(1, echoMessage)
+		sm.Module = server.NewTCPModule(ts)
+	default:
+		eh := server.NewEasyHandler()
+		eh.GET("/", hello)
+		sm.Module = server.NewHTTPModule(eh)
+	}
+
+	return sm.Module.Start(ctx)
+}
+
+// Exit code of the module which failed to start
+func startErrorCode(err error) int {
+	var se *lifecycle.StartError
+	if errors.As(err, &se) {
+		switch se.Module {
+		case configure.ConfigModuleName:
+			return configure.InitConfigError
+		case logging.LogModuleName:
+			return configure.InitLogError
+		}
+	}
+	return configure.InitServerError
+}
+
 func hello(context server.Context) error {
 	res := make(map[string]interface{})
 	res["message"] = "ok"
@@ -68,22 +145,74 @@ func hello(context server.Context) error {
 
 }
 
-// Wait signal
-func waitSignal() {
-	sigChan := make(chan os.Signal)
-	signal.Notify(sigChan)
+func echoMessage(conn *server.TCPConn, msg *server.Message) error {
+	return conn.Send(msg)
+}
+
+// Register the signal handlers
+func initSignal() {
+	stopTimeout := configure.DefaultDuration("app.stop_timeout", 60*time.Second)
+	graceful.InitSignalManager(stopTimeout)
+	sm := graceful.GetSignalManager()
+
+	// Reload the configure, the TLS certificate is reloaded by its own module
+	sm.Handle(syscall.SIGHUP, func(sig os.Signal) {
+		logReload(configure.Reload())
+	})
+
+	handleConfigSignal(sm, "app.restart_signal", "SIGUSR2", func(sig os.Signal) {
+		// The new process sends SIGTERM once it is serving
+		pid, err := graceful.Restart(func(pid int, err error) {
+			logging.ErrorF("restart: new process %d exited : %v", pid, err)
+		})
+		if err != nil {
+			logging.ErrorF("restart error: %s", err)
+		} else {
+			logging.InfoF("restart: new process %d", pid)
+		}
+	})
+
+	handleConfigSignal(sm, "app.reopen_log_signal", "SIGUSR1", func(sig os.Signal) {
+		if err := logging.Reopen(); err != nil {
+			logging.ErrorF("reopen log error: %s", err)
+		}
+	})
+
+	handleConfigSignal(sm, "app.dump_signal", "SIGTTIN", func(sig os.Signal) {
+		logging.InfoF("goroutine dump:\n%s", graceful.GoroutineStacks())
+	})
+}
 
-	sig := <-sigChan
+// Log the result of a configure reload
+func logReload(err error) {
+	if err != nil {
+		logging.ErrorF("reload configure error, keep the old one: %s", err)
+		return
+	}
+	logging.Info("configure reloaded")
+}
+
+// Register h for the signal named by the configuration key
+func handleConfigSignal(sm *graceful.SignalManager, key string, defaultSig string, h graceful.SignalHandler) {
+	sig, err := graceful.ParseSignal(configure.DefaultString(key, defaultSig))
+	if err == nil {
+		err = sm.Handle(sig, h)
+	}
+	if err != nil {
+		logging.ErrorF("%s: %s", key, err)
+	}
+}
 
-	logging.TraceF("signal: %d", sig)
+// Wait signal
+func waitSignal() {
+	report, err := graceful.GetSignalManager().Run()
+	if err == nil {
+		return
+	}
 
-	switch sig {
-	case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
-		logging.Trace("exit...")
-		graceful.GetExitList().Stop()
-	case syscall.SIGUSR1:
-		logging.Trace("catch the signal SIGUSR1")
-	default:
-		logging.Trace("signal do not know")
+	// The log module is stopped already
+	for _, m := range report.Failed() {
+		fmt.Printf("exit error : module %s, stage %d, took %s, timed out %t : %s\n",
+			m.Name, m.Stage, m.Duration, m.TimedOut, m.Err)
 	}
 }
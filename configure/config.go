@@ -11,6 +11,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var appConfig *Config
@@ -26,33 +27,67 @@ type Config struct {
 
 	// Section:key=value
 	data map[string]map[string]string
+
+	// Section selected by -m, the section of a key without "section::"
+	mode string
+
+	// Section:parent section, from [section : parent]
+	parents map[string]string
+
+	// Section:key=section the value is inherited from
+	inherited map[string]map[string]string
+
+	// Configuration file
+	filePath string
+
+	// Values over the selected mode, see override.go
+	env       map[string]override
+	flags     map[string]override
+	overrides []string
+
+	// See reload.go
+	reloadMu   sync.Mutex
+	watchers   []*watcher
+	validators []ValidateFunc
 }
 
 // Initialize configure
-func InitConfig(filePath string, mod string) error {
+// The mod section of filePath is overridden by the LILGO_* environment variables,
+// which are overridden by overrides, in the form of key=value.
+func InitConfig(filePath string, mod string, overrides ...string) error {
 	if !utils.FileExists(filePath) {
 		return errors.New("no such file or dir")
 	}
 
-	appConfig = &Config{}
+	appConfig = &Config{overrides: overrides}
 	err := appConfig.parse(filePath, mod)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	appConfig.loadEnv(os.Environ())
+
+	return appConfig.loadFlags(overrides)
 }
 
 // Parse the configuration file
+// Every section is kept. A section declared as [section : parent] gets the keys
+// of parent which it does not set itself.
 func (c *Config) parse(fileName string, mod string) error {
-	c.Lock()
 	f, err := os.Open(fileName)
 	if err != nil {
 		return err
 	}
-	defer c.Unlock()
 	defer f.Close()
 
+	c.Lock()
+	defer c.Unlock()
+
+	c.filePath = fileName
+	c.mode = strings.ToLower(mod)
+	c.parents = make(map[string]string)
+	c.inherited = make(map[string]map[string]string)
+
 	buf := bufio.NewReader(f)
 
 	var section string
@@ -71,41 +106,122 @@ func (c *Config) parse(fileName string, mod string) error {
 
 		line = bytes.TrimSpace(line)
 		switch {
+		case len(line) == 0:
+			continue
 		case bytes.HasPrefix(line, DefaultComment):
 			continue
 		case bytes.HasPrefix(line, DefaultCommentSem):
 			continue
 		case bytes.HasPrefix(line, []byte{'['}) && bytes.HasSuffix(line, []byte{']'}):
-			section = string(line[1 : len(line)-1])
+			nameParent := bytes.SplitN(line[1:len(line)-1], []byte{':'}, 2)
+			section = strings.ToLower(string(bytes.TrimSpace(nameParent[0])))
+			if section == "" {
+				return fmt.Errorf("parse %s the section error : line %d , empty section name", fileName, lineNum)
+			}
+			if len(nameParent) == 2 {
+				parent := strings.ToLower(string(bytes.TrimSpace(nameParent[1])))
+				if old, ok := c.parents[section]; ok && old != parent {
+					return fmt.Errorf("parse %s the section error : line %d , [%s] extends both %s and %s", fileName, lineNum, section, old, parent)
+				}
+				c.parents[section] = parent
+			}
+			if _, ok := c.data[section]; !ok {
+				c.addSection(section)
+			}
 			continue
 		default:
-			if section == mod {
-				optionVal := bytes.SplitN(line, []byte{'='}, 2)
-				if len(optionVal) != 2 {
-					return fmt.Errorf("parse %s the content error : line %d , %s = ? ", fileName, lineNum, optionVal[0])
+			optionVal := bytes.SplitN(line, []byte{'='}, 2)
+			if len(optionVal) != 2 {
+				return fmt.Errorf("parse %s the content error : line %d , %s = ? ", fileName, lineNum, optionVal[0])
+			}
+			option := bytes.TrimSpace(optionVal[0])
+			value := bytes.TrimSpace(optionVal[1])
+			c.AddConfig(section, string(option), string(value))
+		}
+	}
+
+	if err := c.inherit(); err != nil {
+		return fmt.Errorf("parse %s the section error : %s", fileName, err)
+	}
+
+	if _, ok := c.data[c.mode]; !ok {
+		return fmt.Errorf("parse %s the section error : no section [%s]", fileName, c.mode)
+	}
+
+	return nil
+}
+
+// Copy the keys of the parent sections into their children
+func (c *Config) inherit() error {
+	done := make(map[string]bool, len(c.data))
+
+	var resolve func(section string, path []string) error
+	resolve = func(section string, path []string) error {
+		if done[section] {
+			return nil
+		}
+
+		path = append(path, section)
+		parent, ok := c.parents[section]
+		if ok {
+			for _, s := range path {
+				if s == parent {
+					return fmt.Errorf("extends cycle %s -> %s", strings.Join(path, " -> "), parent)
 				}
-				option := bytes.TrimSpace(optionVal[0])
-				value := bytes.TrimSpace(optionVal[1])
-				c.AddConfig(section, string(option), string(value))
 			}
+			if _, exist := c.data[parent]; !exist {
+				return fmt.Errorf("[%s] extends unknown section [%s]", section, parent)
+			}
+			if err := resolve(parent, path); err != nil {
+				return err
+			}
+
+			inherited := make(map[string]string)
+			for option, value := range c.data[parent] {
+				if _, set := c.data[section][option]; !set {
+					c.data[section][option] = value
+					inherited[option] = parent
+					if from, ok := c.inherited[parent][option]; ok {
+						inherited[option] = from
+					}
+				}
+			}
+			c.inherited[section] = inherited
+		}
+		done[section] = true
+
+		return nil
+	}
+
+	for section := range c.data {
+		if err := resolve(section, nil); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// Add an empty section
+func (c *Config) addSection(section string) {
+	if len(c.data) == 0 {
+		c.data = make(map[string]map[string]string)
+	}
+
+	c.data[section] = make(map[string]string)
+}
+
 // AddConfig adds a new section->key:value to the configuration.
+// Section and key are case insensitive.
 func (c *Config) AddConfig(section string, option string, value string) bool {
 	if section == "" {
 		section = DefaultSelection
 	}
-
-	if len(c.data) == 0 {
-		c.data = make(map[string]map[string]string)
-	}
+	section = strings.ToLower(section)
+	option = strings.ToLower(option)
 
 	if _, ok := c.data[section]; !ok {
-		c.data[section] = make(map[string]string)
+		c.addSection(section)
 	}
 
 	_, ok := c.data[section][option]
@@ -114,21 +230,20 @@ func (c *Config) AddConfig(section string, option string, value string) bool {
 	return !ok
 }
 
-// Get section.key or key
+// Get section::key, or key of the selected mode
 func (c *Config) get(key string) string {
-	var (
-		section string
-		option  string
-	)
+	section, option := c.splitKey(key)
 
-	keys := strings.Split(strings.ToLower(key), "::")
+	c.RLock()
+	defer c.RUnlock()
 
-	if len(keys) >= 2 {
-		section = keys[0]
-		option = keys[1]
-	} else {
-		section = DefaultSelection
-		option = keys[0]
+	if section == c.mode {
+		if o, ok := c.flags[option]; ok {
+			return o.value
+		}
+		if o, ok := c.env[option]; ok {
+			return o.value
+		}
 	}
 
 	if value, ok := c.data[section][option]; ok {
@@ -138,6 +253,24 @@ func (c *Config) get(key string) string {
 	return ""
 }
 
+// Split section::key, the section of key is the selected mode
+func (c *Config) splitKey(key string) (section string, option string) {
+	keys := strings.SplitN(strings.ToLower(key), "::", 2)
+
+	if len(keys) == 2 {
+		section = keys[0]
+		option = keys[1]
+	} else {
+		section = c.mode
+		option = keys[0]
+	}
+	if section == "" {
+		section = DefaultSelection
+	}
+
+	return section, option
+}
+
 func DefaultString(key string, defaultVal string) string {
 	if v := appConfig.String(key); v != "" {
 		return v
@@ -166,6 +299,22 @@ func DefaultInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+// DefaultDuration reads a duration such as 500ms or 30s, a plain integer is seconds.
+func DefaultDuration(key string, defaultVal time.Duration) time.Duration {
+	if d, err := appConfig.Duration(key); err == nil {
+		return d
+	}
+	return defaultVal
+}
+
+// DefaultBytes reads a size such as 256KB or 1.8GB, a plain integer is bytes.
+func DefaultBytes(key string, defaultVal int64) int64 {
+	if b, err := appConfig.Bytes(key); err == nil {
+		return b
+	}
+	return defaultVal
+}
+
 func (c *Config) Bool(key string) (bool, error) {
 	return strconv.ParseBool(c.get(key))
 }
@@ -182,6 +331,17 @@ func (c *Config) Float64(key string) (float64, error) {
 	return strconv.ParseFloat(c.get(key), 64)
 }
 
+// Duration parses a duration such as 500ms or 30s, a plain integer is seconds.
+func (c *Config) Duration(key string) (time.Duration, error) {
+	return parseDuration(c.get(key))
+}
+
+// Bytes parses a size such as 256KB or 1.8GB in powers of 1024, a plain
+// integer is bytes.
+func (c *Config) Bytes(key string) (int64, error) {
+	return parseBytes(c.get(key))
+}
+
 func (c *Config) String(key string) string {
 	return c.get(key)
 }
@@ -0,0 +1,127 @@
+package configure
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Parse content as app.ini with the mode section selected
+func parseConfig(t *testing.T, content string, mode string) (*Config, error) {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "app.ini")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{}
+	return c, c.parse(filePath, mode)
+}
+
+const inheritINI = `
+[local]
+host = 127.0.0.1
+app.debug = true
+log.level = debug
+
+[online : local]
+host = 192.168.10.100
+app.debug = false
+
+[gray : online]
+log.level = info
+`
+
+func TestConfigInherit(t *testing.T) {
+	c, err := parseConfig(t, inheritINI, "gray")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		// Set by the selected section
+		{"log.level", "info"},
+		// From the parent
+		{"host", "192.168.10.100"},
+		{"app.debug", "false"},
+		// From the parent of the parent
+		{"gray::log.level", "info"},
+		{"online::log.level", "debug"},
+		{"online::host", "192.168.10.100"},
+		{"local::host", "127.0.0.1"},
+		{"LOCAL::Host", "127.0.0.1"},
+		{"local::missing", ""},
+		{"unknown::host", ""},
+	}
+
+	for _, tt := range tests {
+		if got := c.String(tt.key); got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestConfigInheritError(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"cycle", "[a : b]\n[b : c]\n[c : a]\n", "extends cycle"},
+		{"self", "[a : a]\n", "extends cycle"},
+		{"unknown parent", "[a : x]\n", "extends unknown section [x]"},
+		{"two parents", "[a : b]\n[a : c]\n[b]\n[c]\n", "extends both"},
+		{"no selected section", "[b]\nx = 1\n", "no section [a]"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseConfig(t, tt.content, "a")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestConfigSource(t *testing.T) {
+	c, err := parseConfig(t, inheritINI, "gray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.loadEnv([]string{"LILGO_HOST=10.0.0.1", "HOST=ignored", "_LILGO_PARENT_PID=1"})
+	if err := c.loadFlags([]string{"app.debug=true"}); err != nil {
+		t.Fatal(err)
+	}
+
+	file := SourceFile + " " + c.filePath
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"app.debug", SourceFlag + " -set app.debug=true"},
+		{"host", SourceEnv + " LILGO_HOST"},
+		{"log.level", file + " [gray]"},
+		{"online::log.level", file + " [local]"},
+		{"online::host", file + " [online]"},
+		// The overrides only apply to the selected section
+		{"local::host", file + " [local]"},
+		{"missing", ""},
+	}
+
+	for _, tt := range tests {
+		if got := c.Source(tt.key); got != tt.want {
+			t.Errorf("Source(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+
+	if got := c.String("host"); got != "10.0.0.1" {
+		t.Errorf("String(host) = %q, want the environment variable", got)
+	}
+	if got := c.Overridden(); strings.Join(got, ",") != "app.debug,host" {
+		t.Errorf("Overridden() = %v, want [app.debug host]", got)
+	}
+}
@@ -8,6 +8,7 @@ var Pid = os.Getpid()
 const (
 	InitConfigError = iota + 1
 	InitLogError
+	InitServerError
 )
 
 // Error message
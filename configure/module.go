@@ -0,0 +1,73 @@
+package configure
+
+import (
+	"context"
+	"fmt"
+	"github.com/xxlixin1993/LiLGo/graceful"
+)
+
+// Configure module name
+const ConfigModuleName = "configModule"
+
+// Module loads the configuration file as a lifecycle module. When
+// app.config_watch_interval is set, the file is reloaded once it is modified.
+type Module struct {
+	filePath  string
+	mod       string
+	overrides []string
+	quit      chan struct{}
+
+	// Called after every reload on file change, errors are printed when it is nil
+	ReloadHandler func(error)
+}
+
+// Returns a instance of *Module which loads the mod section of filePath,
+// see InitConfig for overrides
+func NewModule(filePath string, mod string, overrides ...string) *Module {
+	return &Module{
+		filePath:  filePath,
+		mod:       mod,
+		overrides: overrides,
+	}
+}
+
+// Implement lifecycle.Module
+func (m *Module) GetModuleName() string {
+	return ConfigModuleName
+}
+
+// Implement lifecycle.Module
+func (m *Module) Start(ctx context.Context) error {
+	if err := InitConfig(m.filePath, m.mod, m.overrides...); err != nil {
+		return err
+	}
+
+	if interval := DefaultDuration("app.config_watch_interval", 0); interval > 0 {
+		m.quit = make(chan struct{})
+		go appConfig.WatchFile(interval, m.quit, m.onReload)
+	}
+
+	return nil
+}
+
+// Implement lifecycle.Module
+func (m *Module) Stop(ctx context.Context) error {
+	if m.quit != nil {
+		close(m.quit)
+	}
+	return nil
+}
+
+// Implement StageInterface
+func (m *Module) GetStopStage() int {
+	return graceful.StageConfig
+}
+
+func (m *Module) onReload(err error) {
+	if m.ReloadHandler != nil {
+		m.ReloadHandler(err)
+	} else if err != nil {
+		// The log module depends on configure
+		fmt.Printf("[Configure] reload error : %s\n", err)
+	}
+}
@@ -0,0 +1,161 @@
+package configure
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Precedence of the configuration layers, from the highest to the lowest:
+//   1. -set key=value on the command line
+//   2. environment variable, LILGO_HTTP_READ_TIMEOUT for http.read_timeout
+//   3. the section selected by -m in app.ini
+//   4. the sections it extends, see [section : parent]
+// The overrides only apply to the selected section, section::key of another
+// section always reads app.ini.
+
+// Prefix of the environment variables which override the configuration
+const EnvPrefix = "LILGO_"
+
+// Configuration layers, see Source
+const (
+	SourceFlag = "flag"
+	SourceEnv  = "env"
+	SourceFile = "file"
+)
+
+// A value over the selected section
+type override struct {
+	value string
+
+	// The variable or flag which sets it
+	from string
+}
+
+// Load the environment variables, in the form of os.Environ
+// The name is matched against the keys of app.ini, e.g. LILGO_HTTP_READ_TIMEOUT
+// is http.read_timeout. A name matching no key maps its first '_' to '.', e.g.
+// LILGO_HTTP_TLS_CERT is http.tls_cert and LILGO_HOST is host.
+func (c *Config) loadEnv(environ []string) {
+	c.Lock()
+	defer c.Unlock()
+
+	known := make(map[string]string)
+	for _, section := range c.data {
+		for option := range section {
+			known[EnvName(option)] = option
+		}
+	}
+
+	c.env = make(map[string]override)
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) || len(name) == len(EnvPrefix) {
+			continue
+		}
+
+		option, ok := known[name]
+		if !ok {
+			option = strings.ToLower(strings.Replace(name[len(EnvPrefix):], "_", ".", 1))
+		}
+		c.env[option] = override{value: value, from: name}
+	}
+}
+
+// Load the -set flags, in the form of key=value
+func (c *Config) loadFlags(flags []string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.flags = make(map[string]override)
+	for _, kv := range flags {
+		option, value, err := ParseOverride(kv)
+		if err != nil {
+			return err
+		}
+		c.flags[option] = override{value: value, from: kv}
+	}
+
+	return nil
+}
+
+// ParseOverride splits key=value, the key is lower cased.
+func ParseOverride(kv string) (key string, value string, err error) {
+	key, value, ok := strings.Cut(kv, "=")
+	key = strings.ToLower(strings.TrimSpace(key))
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("override %q is not in the form of key=value", kv)
+	}
+	if strings.Contains(key, "::") {
+		return "", "", fmt.Errorf("override %q: only the selected section can be overridden", kv)
+	}
+
+	return key, strings.TrimSpace(value), nil
+}
+
+// EnvName returns the environment variable which overrides key.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Source tells the layer the value of key comes from, and where it is set:
+//
+//	flag -set http.read_timeout=5
+//	env LILGO_HTTP_READ_TIMEOUT
+//	file ./app.ini [online]
+//	file ./app.ini [local]    inherited by the selected section
+//
+// It is empty when key is not set.
+func (c *Config) Source(key string) string {
+	section, option := c.splitKey(key)
+
+	c.RLock()
+	defer c.RUnlock()
+
+	if section == c.mode {
+		if o, ok := c.flags[option]; ok {
+			return SourceFlag + " -set " + o.from
+		}
+		if o, ok := c.env[option]; ok {
+			return SourceEnv + " " + o.from
+		}
+	}
+
+	if _, ok := c.data[section][option]; !ok {
+		return ""
+	}
+	if from, ok := c.inherited[section][option]; ok {
+		section = from
+	}
+
+	return SourceFile + " " + c.filePath + " [" + section + "]"
+}
+
+// Overridden returns the keys set by the environment variables or -set, sorted.
+func (c *Config) Overridden() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := make([]string, 0, len(c.env)+len(c.flags))
+	for option := range c.env {
+		keys = append(keys, option)
+	}
+	for option := range c.flags {
+		if _, ok := c.env[option]; !ok {
+			keys = append(keys, option)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Overridden returns the keys set by the environment variables or -set.
+func Overridden() []string {
+	return appConfig.Overridden()
+}
+
+// Source tells the layer the value of key comes from, see Config.Source.
+func Source(key string) string {
+	return appConfig.Source(key)
+}
@@ -0,0 +1,160 @@
+package configure
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+type (
+	// WatchFunc is called with the old and the new value of a changed key.
+	WatchFunc func(old string, new string)
+
+	// ValidateFunc checks a reloaded configuration before it is used.
+	ValidateFunc func(next *Config) error
+
+	watcher struct {
+		key string
+		fn  WatchFunc
+	}
+)
+
+// Reload parses the configuration file again, together with the environment and
+// the same -set overrides. The new configuration is checked by the validators and
+// replaces the old one at once, the old one is kept when anything fails. The
+// watchers of the changed keys are called after the swap.
+func (c *Config) Reload() error {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	c.RLock()
+	filePath, mode, overrides := c.filePath, c.mode, c.overrides
+	validators := c.validators
+	c.RUnlock()
+
+	next := &Config{overrides: overrides}
+	if err := next.parse(filePath, mode); err != nil {
+		return err
+	}
+	next.loadEnv(os.Environ())
+	if err := next.loadFlags(overrides); err != nil {
+		return err
+	}
+
+	for _, validate := range validators {
+		if err := validate(next); err != nil {
+			return fmt.Errorf("validate %s error : %s", filePath, err)
+		}
+	}
+
+	// Swap
+	c.Lock()
+	prev := &Config{
+		data:      c.data,
+		mode:      c.mode,
+		parents:   c.parents,
+		inherited: c.inherited,
+		filePath:  c.filePath,
+		env:       c.env,
+		flags:     c.flags,
+	}
+	c.data = next.data
+	c.parents = next.parents
+	c.inherited = next.inherited
+	c.env = next.env
+	c.flags = next.flags
+	watchers := c.watchers
+	c.Unlock()
+
+	for _, w := range watchers {
+		if before, after := prev.get(w.key), c.get(w.key); before != after {
+			w.fn(before, after)
+		}
+	}
+
+	return nil
+}
+
+// Watch calls fn when the value of key is changed by Reload, until the returned
+// unwatch is called. The key is the same as the one of String, e.g. log.level or
+// local::host.
+func (c *Config) Watch(key string, fn WatchFunc) (unwatch func()) {
+	w := &watcher{key: key, fn: fn}
+
+	c.Lock()
+	c.watchers = append(c.watchers, w)
+	c.Unlock()
+
+	return func() {
+		c.Lock()
+		defer c.Unlock()
+
+		// A new slice, Reload may be walking the old one
+		watchers := make([]*watcher, 0, len(c.watchers))
+		for _, cw := range c.watchers {
+			if cw != w {
+				watchers = append(watchers, cw)
+			}
+		}
+		c.watchers = watchers
+	}
+}
+
+// AddValidator adds a check of the configuration loaded by Reload.
+func (c *Config) AddValidator(validate ValidateFunc) {
+	c.Lock()
+	c.validators = append(c.validators, validate)
+	c.Unlock()
+}
+
+// WatchFile reloads the configuration when the file is modified, it checks the
+// file every interval until quit is closed. The result of every reload is passed
+// to onReload.
+func (c *Config) WatchFile(interval time.Duration, quit <-chan struct{}, onReload func(error)) {
+	c.RLock()
+	filePath := c.filePath
+	c.RUnlock()
+
+	lastMod, lastSize := fileVersion(filePath)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			mod, size := fileVersion(filePath)
+			if mod.Equal(lastMod) && size == lastSize {
+				continue
+			}
+			lastMod, lastSize = mod, size
+			onReload(c.Reload())
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Modification time and size of the file, zero when it can not be read
+func fileVersion(filePath string) (time.Time, int64) {
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return fi.ModTime(), fi.Size()
+}
+
+// Reload the configuration, see Config.Reload
+func Reload() error {
+	return appConfig.Reload()
+}
+
+// Watch the value of key, see Config.Watch
+func Watch(key string, fn WatchFunc) (unwatch func()) {
+	return appConfig.Watch(key, fn)
+}
+
+// Add a check of the reloaded configuration, see Config.AddValidator
+func AddValidator(validate ValidateFunc) {
+	appConfig.AddValidator(validate)
+}
@@ -0,0 +1,55 @@
+package configure
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConfigWatch(t *testing.T) {
+	c, err := parseConfig(t, "[local]\na = 1\nb = 1\n", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []string
+	watch := func(key string) func() {
+		return c.Watch(key, func(old, new string) {
+			changes = append(changes, key+":"+old+">"+new)
+		})
+	}
+	unwatchA := watch("a")
+	watch("b")
+	unwatchA2 := watch("a")
+
+	reload := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(c.filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reload("[local]\na = 2\nb = 1\n")
+	if want := []string{"a:1>2", "a:1>2"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+
+	// Only the watcher of the unwatch is removed, a second call does nothing
+	changes = nil
+	unwatchA()
+	unwatchA()
+	reload("[local]\na = 3\nb = 2\n")
+	if want := []string{"b:1>2", "a:2>3"}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+
+	changes = nil
+	unwatchA2()
+	reload("[local]\na = 4\nb = 2\n")
+	if len(changes) != 0 {
+		t.Errorf("changes = %v after unwatch", changes)
+	}
+}
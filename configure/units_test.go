@@ -0,0 +1,63 @@
+package configure
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"500ms", 500 * time.Millisecond, false},
+		{"30s", 30 * time.Second, false},
+		{"1m30s", 90 * time.Second, false},
+		{"30", 30 * time.Second, false},
+		{" 5 ", 5 * time.Second, false},
+		{"0", 0, false},
+		{"9999999999999", 0, true},
+		{"", 0, true},
+		{"5 seconds", 0, true},
+		{"ms", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, %v, want %v, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"0", 0, false},
+		{"256KB", 256 << 10, false},
+		{"1 MB", 1 << 20, false},
+		{"64kib", 64 << 10, false},
+		{"1.8GB", 1932735283, false},
+		{"2T", 2 << 40, false},
+		{"10B", 10, false},
+		{"-1", 0, true},
+		{"-1KB", 0, true},
+		{"KB", 0, true},
+		{"", 0, true},
+		{"1.2.3MB", 0, true},
+		{"10XB", 0, true},
+		{"9999999TB", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseBytes(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseBytes(%q) = %d, %v, want %d, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
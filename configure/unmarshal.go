@@ -0,0 +1,265 @@
+package configure
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Unmarshal fills the struct pointed by v with the keys under prefix.
+//
+// The key of a field is prefix.name, name is given by the config tag or is the
+// snake case of the field name, e.g. ReadTimeout is read_timeout. The tag may be
+// followed by options:
+//
+//	ReadTimeout    time.Duration `config:"read_timeout" default:"3s"`
+//	MaxFrameLength int64         `config:"max_frame_length,size" default:"64KB"`
+//	Cert           string        `config:"tls_cert,required"`
+//	Ports          []int         `config:"ports"`
+//	Skipped        string        `config:"-"`
+//
+// A key which is not set gets the default tag, a field without default keeps its
+// value. A required key must be set or have a default. Durations are "500ms",
+// "30s" or seconds, sizes are "256KB", "1.8GB" or bytes, lists are separated by
+// ','. A nested struct reads the keys under prefix.name, an embedded struct the
+// keys under prefix.
+//
+// All missing and invalid keys are reported in one *UnmarshalError.
+func (c *Config) Unmarshal(prefix string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("configure: Unmarshal needs a non-nil pointer to a struct")
+	}
+
+	ue := &UnmarshalError{}
+	c.unmarshalStruct(prefix, rv.Elem(), ue)
+	if len(ue.Errors) != 0 {
+		return ue
+	}
+
+	return nil
+}
+
+// Unmarshal the keys under prefix, see Config.Unmarshal
+func Unmarshal(prefix string, v interface{}) error {
+	return appConfig.Unmarshal(prefix, v)
+}
+
+type (
+	// UnmarshalError lists every missing or invalid key of Unmarshal.
+	UnmarshalError struct {
+		Errors []*KeyError
+	}
+
+	// KeyError is a missing or invalid key.
+	KeyError struct {
+		Key   string
+		Value string
+		Err   error
+	}
+
+	// Options after the name in the config tag
+	tagOptions struct {
+		required bool
+		size     bool
+	}
+)
+
+// ErrMissingKey is the error of a required key which is not set.
+var ErrMissingKey = errors.New("missing")
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Fill the fields of rv
+func (c *Config) unmarshalStruct(prefix string, rv reflect.Value, ue *UnmarshalError) {
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("config")
+		name, opts := parseTag(tag)
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = snakeCase(field.Name)
+		}
+		key := joinKey(prefix, name)
+		fv := rv.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			if field.Anonymous && tag == "" {
+				key = prefix
+			}
+			c.unmarshalStruct(key, fv, ue)
+			continue
+		}
+
+		value := c.get(key)
+		if value == "" {
+			value = field.Tag.Get("default")
+		}
+		if value == "" {
+			if opts.required {
+				ue.Errors = append(ue.Errors, &KeyError{Key: key, Err: ErrMissingKey})
+			}
+			continue
+		}
+
+		if err := setField(fv, value, opts); err != nil {
+			ue.Errors = append(ue.Errors, &KeyError{Key: key, Value: value, Err: err})
+		}
+	}
+}
+
+// Set the field from the value of its key
+func setField(fv reflect.Value, value string, opts tagOptions) error {
+	if fv.Type() == durationType {
+		d, err := parseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		var err error
+		if opts.size {
+			n, err = parseBytes(value)
+		} else {
+			n, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return err
+		}
+		if fv.OverflowInt(n) {
+			return fmt.Errorf("%d overflows %s", n, fv.Type())
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if opts.size {
+			size, err := parseBytes(value)
+			if err != nil {
+				return err
+			}
+			n = uint64(size)
+		} else {
+			var err error
+			if n, err = strconv.ParseUint(value, 10, 64); err != nil {
+				return err
+			}
+		}
+		if fv.OverflowUint(n) {
+			return fmt.Errorf("%d overflows %s", n, fv.Type())
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+
+		slice := reflect.MakeSlice(fv.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setField(slice.Index(i), item, opts); err != nil {
+				return fmt.Errorf("item %d: %v", i, err)
+			}
+		}
+		fv.Set(slice)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+
+	return nil
+}
+
+// Split the config tag into the name and the options
+func parseTag(tag string) (string, tagOptions) {
+	var opts tagOptions
+
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		switch strings.TrimSpace(opt) {
+		case "required":
+			opts.required = true
+		case "size":
+			opts.size = true
+		}
+	}
+
+	return strings.TrimSpace(parts[0]), opts
+}
+
+// Join prefix and name with '.'
+func joinKey(prefix string, name string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "::") {
+		return prefix + name
+	}
+	return prefix + "." + name
+}
+
+// ReadTimeout to read_timeout, HTTPPort to http_port
+func snakeCase(name string) string {
+	runes := []rune(name)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func (ue *UnmarshalError) Error() string {
+	errInfo := make([]string, 0, len(ue.Errors))
+	for _, ke := range ue.Errors {
+		errInfo = append(errInfo, ke.Error())
+	}
+	return "configure: " + strings.Join(errInfo, "; ")
+}
+
+func (ke *KeyError) Error() string {
+	if ke.Value == "" {
+		return ke.Key + ": " + ke.Err.Error()
+	}
+	return fmt.Sprintf("%s = %q: %v", ke.Key, ke.Value, ke.Err)
+}
+
+func (ke *KeyError) Unwrap() error {
+	return ke.Err
+}
@@ -0,0 +1,118 @@
+package configure
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Host", "host"},
+		{"ReadTimeout", "read_timeout"},
+		{"HTTPPort", "http_port"},
+		{"MaxFrameLength", "max_frame_length"},
+		{"TLSCert", "tls_cert"},
+		{"ID", "id"},
+		{"UserID", "user_id"},
+	}
+
+	for _, tt := range tests {
+		if got := snakeCase(tt.in); got != tt.want {
+			t.Errorf("snakeCase(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+const unmarshalINI = `
+[local]
+http.port = 8080
+http.read_timeout = 500ms
+http.max_body = 1 MB
+http.hosts = a, b,, c
+`
+
+type httpConfig struct {
+	Port         int           `config:"port"`
+	ReadTimeout  time.Duration `config:"read_timeout" default:"3s"`
+	WriteTimeout time.Duration `default:"5s"`
+	MaxBody      int64         `config:"max_body,size"`
+	Hosts        []string
+	Debug        bool
+	Skipped      string `config:"-" default:"x"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	c, err := parseConfig(t, unmarshalINI, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hc httpConfig
+	if err := c.Unmarshal("http", &hc); err != nil {
+		t.Fatal(err)
+	}
+
+	want := httpConfig{
+		Port:         8080,
+		ReadTimeout:  500 * time.Millisecond,
+		WriteTimeout: 5 * time.Second,
+		MaxBody:      1 << 20,
+		Hosts:        []string{"a", "b", "c"},
+	}
+	if hc.Port != want.Port || hc.ReadTimeout != want.ReadTimeout || hc.WriteTimeout != want.WriteTimeout ||
+		hc.MaxBody != want.MaxBody || len(hc.Hosts) != 3 || hc.Hosts[2] != "c" || hc.Debug || hc.Skipped != "" {
+		t.Errorf("Unmarshal = %+v, want %+v", hc, want)
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	c, err := parseConfig(t, `
+[local]
+tcp.port = http
+tcp.read_timeout = soon
+tcp.max_frame_length = 1.8XB
+tcp.length_size = 300
+`, "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tc struct {
+		Port           int           `config:"port"`
+		ReadTimeout    time.Duration `config:"read_timeout"`
+		MaxFrameLength int64         `config:"max_frame_length,size"`
+		LengthSize     uint8         `config:"length_size"`
+		Cert           string        `config:"tls_cert,required"`
+		Key            string        `config:"tls_key,required" default:"key.pem"`
+	}
+	err = c.Unmarshal("tcp", &tc)
+
+	var ue *UnmarshalError
+	if !errors.As(err, &ue) {
+		t.Fatalf("Unmarshal error = %v, want *UnmarshalError", err)
+	}
+
+	want := []string{"tcp.port", "tcp.read_timeout", "tcp.max_frame_length", "tcp.length_size", "tcp.tls_cert"}
+	if len(ue.Errors) != len(want) {
+		t.Fatalf("Unmarshal error = %v, want the keys %v", err, want)
+	}
+	for i, ke := range ue.Errors {
+		if ke.Key != want[i] {
+			t.Errorf("Errors[%d].Key = %q, want %q", i, ke.Key, want[i])
+		}
+	}
+	if last := ue.Errors[len(ue.Errors)-1]; !errors.Is(last, ErrMissingKey) {
+		t.Errorf("%v is not ErrMissingKey", last)
+	}
+	if tc.Key != "key.pem" {
+		t.Errorf("Key = %q, want the default", tc.Key)
+	}
+
+	if err := c.Unmarshal("tcp", tc); err == nil {
+		t.Error("Unmarshal of a struct value succeeded, want an error")
+	}
+}
@@ -1,13 +1,28 @@
 package graceful
 
 import (
-	"container/list"
+	"context"
 	"errors"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 var exitList *ExitList
 
+// Stop stages, modules of a smaller stage are stopped first
+const (
+	// Servers stop accepting and drain the requests in hand
+	StageServer = 100
+	// Modules which do not declare a stage
+	StageDefault = 200
+	// Log stops after the modules, so that they can log while stopping
+	StageLog = 300
+	// Configure stops last, every module may read it
+	StageConfig = 400
+)
+
 type ExitInterface interface {
 	// get module name
 	GetModuleName() string
@@ -16,19 +31,55 @@ type ExitInterface interface {
 	Stop() error
 }
 
+// StageInterface is implemented by modules which declare their stop stage.
+type StageInterface interface {
+	// Modules of the same stage are stopped concurrently
+	GetStopStage() int
+}
+
+// ContextStopper is implemented by modules which can stop within a context.
+// Modules which do not implement it are abandoned when their time is up.
+type ContextStopper interface {
+	StopContext(ctx context.Context) error
+}
+
 type ExitList struct {
-	// exit list
-	ll *list.List
+	mu sync.Mutex
+
+	// exit list, in registration order
+	modules []*exitModule
 
 	// module name map
-	module map[string]*list.Element
+	module map[string]*exitModule
+
+	// Time limit of every module, 0 means only the deadline of Stop applies
+	moduleTimeout time.Duration
+}
+
+type exitModule struct {
+	ExitInterface
+	stage int
+}
+
+// StopReport tells how every module stopped, in stop order.
+type StopReport struct {
+	Modules []ModuleReport
+}
+
+// ModuleReport is the stop result of a module.
+type ModuleReport struct {
+	Name     string
+	Stage    int
+	Duration time.Duration
+	Err      error
+	// Did not stop within its timeout or the deadline of Stop
+	TimedOut bool
 }
 
 // Initialize exit list
 func InitExitList() {
 	exitList = &ExitList{
-		ll:     list.New(),
-		module: make(map[string]*list.Element),
+		module: make(map[string]*exitModule),
 	}
 }
 
@@ -40,47 +91,157 @@ func GetExitList() *ExitList {
 	return exitList
 }
 
-// Inserts a new element exitInterface at the front of exit list
-func (el *ExitList) Pop(exitInterface ExitInterface) error {
+// SetModuleTimeout sets the time limit of every module, 0 means no limit.
+func (el *ExitList) SetModuleTimeout(timeout time.Duration) {
+	el.mu.Lock()
+	el.moduleTimeout = timeout
+	el.mu.Unlock()
+}
+
+// Register adds a module to the exit list. Its stage is GetStopStage when it
+// implements StageInterface, StageDefault otherwise.
+func (el *ExitList) Register(exitInterface ExitInterface) error {
+	stage := StageDefault
+	if si, ok := exitInterface.(StageInterface); ok {
+		stage = si.GetStopStage()
+	}
+	return el.RegisterStage(exitInterface, stage)
+}
+
+// RegisterStage adds a module to the exit list to be stopped in stage.
+func (el *ExitList) RegisterStage(exitInterface ExitInterface, stage int) error {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+
 	if el.module == nil {
-		return errors.New("[Smoothly Exit] Pop: plz init ExitList first")
+		return errors.New("[Smoothly Exit] Register: plz init ExitList first")
 	}
 
 	// Judge whether it exists or not
 	moduleName := exitInterface.GetModuleName()
 	if _, ok := el.module[moduleName]; ok {
-		return errors.New("[Smoothly Exit] Pop: this module(" + moduleName + ") name is exist")
+		return errors.New("[Smoothly Exit] Register: this module(" + moduleName + ") name is exist")
 	}
 
 	// Add value
-	element := el.ll.PushFront(exitInterface)
-	el.module[moduleName] = element
+	m := &exitModule{ExitInterface: exitInterface, stage: stage}
+	el.modules = append(el.modules, m)
+	el.module[moduleName] = m
 
 	return nil
 }
 
+// Deprecated: use Register.
+func (el *ExitList) Pop(exitInterface ExitInterface) error {
+	return el.Register(exitInterface)
+}
+
 // Stop program
-func (el *ExitList) Stop() error {
-	length := el.ll.Len()
-	if length == 0 {
-		return nil
+// Stages are stopped one after another and the modules of a stage concurrently.
+// When ctx is done the modules still stopping and the later stages are reported
+// as timed out. The returned error is nil when every module stopped cleanly.
+func (el *ExitList) Stop(ctx context.Context) (*StopReport, error) {
+	el.mu.Lock()
+	modules := el.modules
+	moduleTimeout := el.moduleTimeout
+	el.modules = nil
+	el.module = make(map[string]*exitModule)
+	el.mu.Unlock()
+
+	// Stable, so that a stage keeps registration order in the report
+	sort.SliceStable(modules, func(i, j int) bool {
+		return modules[i].stage < modules[j].stage
+	})
+
+	report := &StopReport{Modules: make([]ModuleReport, len(modules))}
+	for start := 0; start < len(modules); {
+		end := start
+		for end < len(modules) && modules[end].stage == modules[start].stage {
+			end++
+		}
+
+		if ctx.Err() != nil {
+			for i := start; i < end; i++ {
+				report.Modules[i] = ModuleReport{
+					Name:     modules[i].GetModuleName(),
+					Stage:    modules[i].stage,
+					Err:      ctx.Err(),
+					TimedOut: true,
+				}
+			}
+		} else {
+			var wg sync.WaitGroup
+			for i := start; i < end; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					report.Modules[i] = stopModule(ctx, modules[i], moduleTimeout)
+				}(i)
+			}
+			wg.Wait()
+		}
+
+		start = end
 	}
 
-	errInfo := make([]string, 0)
-	for i := 0; i < length; i++ {
-		element := el.ll.Front()
-		exitElement := element.Value.(ExitInterface)
+	return report, report.Err()
+}
+
+// Stop a module and wait until it returns or its time is up
+func stopModule(ctx context.Context, m *exitModule, timeout time.Duration) ModuleReport {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
-		if err := exitElement.Stop(); err != nil {
-			errInfo = append(errInfo, "[Smoothly Exit]: Stop this module("+exitElement.GetModuleName()+")"+err.Error())
+	begin := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		if cs, ok := m.ExitInterface.(ContextStopper); ok {
+			done <- cs.StopContext(ctx)
+		} else {
+			done <- m.Stop()
 		}
+	}()
+
+	mr := ModuleReport{Name: m.GetModuleName(), Stage: m.stage}
+	select {
+	case mr.Err = <-done:
+	case <-ctx.Done():
+		mr.Err = ctx.Err()
+		mr.TimedOut = true
+	}
+	mr.Duration = time.Since(begin)
 
-		el.ll.Remove(element)
+	return mr
+}
+
+// Failed returns the modules which failed or timed out.
+func (sr *StopReport) Failed() []ModuleReport {
+	var failed []ModuleReport
+	for _, m := range sr.Modules {
+		if m.Err != nil {
+			failed = append(failed, m)
+		}
 	}
+	return failed
+}
 
-	if len(errInfo) > 0 {
-		return errors.New(strings.Join(errInfo, "\n"))
+// Err joins the errors of the failed modules, nil when there is none.
+func (sr *StopReport) Err() error {
+	failed := sr.Failed()
+	if len(failed) == 0 {
+		return nil
 	}
 
-	return nil
+	errInfo := make([]string, 0, len(failed))
+	for _, m := range failed {
+		if m.TimedOut {
+			errInfo = append(errInfo, "[Smoothly Exit]: Stop this module("+m.Name+") timed out after "+m.Duration.String())
+		} else {
+			errInfo = append(errInfo, "[Smoothly Exit]: Stop this module("+m.Name+")"+m.Err.Error())
+		}
+	}
+	return errors.New(strings.Join(errInfo, "\n"))
 }
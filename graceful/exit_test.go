@@ -0,0 +1,265 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Records the order the modules stop in
+type stopRecorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *stopRecorder) add(name string) {
+	r.mu.Lock()
+	r.names = append(r.names, name)
+	r.mu.Unlock()
+}
+
+type testModule struct {
+	name  string
+	stage int
+	// Time Stop takes
+	delay time.Duration
+	err   error
+	rec   *stopRecorder
+}
+
+func (m *testModule) GetModuleName() string {
+	return m.name
+}
+
+func (m *testModule) GetStopStage() int {
+	return m.stage
+}
+
+func (m *testModule) Stop() error {
+	time.Sleep(m.delay)
+	m.rec.add(m.name)
+	return m.err
+}
+
+// Stops as soon as its context is done
+type contextModule struct {
+	testModule
+}
+
+func (m *contextModule) StopContext(ctx context.Context) error {
+	select {
+	case <-time.After(m.delay):
+		m.rec.add(m.name)
+		return m.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestExitListStop(t *testing.T) {
+	failed := errors.New("failed")
+
+	tests := []struct {
+		name          string
+		modules       []testModule
+		moduleTimeout time.Duration
+		timeout       time.Duration
+		// Name:stage in the report
+		want     []string
+		wantErr  []string
+		timedOut []string
+	}{
+		{
+			name: "stages in order, registration order within a stage",
+			modules: []testModule{
+				{name: "config", stage: StageConfig},
+				{name: "log", stage: StageLog},
+				{name: "cache"},
+				{name: "http", stage: StageServer},
+				{name: "tcp", stage: StageServer},
+			},
+			want: []string{"http:100", "tcp:100", "cache:200", "log:300", "config:400"},
+		},
+		{
+			name: "a failed module does not stop the later stages",
+			modules: []testModule{
+				{name: "http", stage: StageServer, err: failed},
+				{name: "log", stage: StageLog},
+			},
+			want:    []string{"http:100", "log:300"},
+			wantErr: []string{"http"},
+		},
+		{
+			name: "module timeout",
+			modules: []testModule{
+				{name: "slow", stage: StageServer, delay: time.Second},
+				{name: "log", stage: StageLog},
+			},
+			moduleTimeout: 20 * time.Millisecond,
+			want:          []string{"slow:100", "log:300"},
+			wantErr:       []string{"slow"},
+			timedOut:      []string{"slow"},
+		},
+		{
+			name: "deadline of Stop times out the later stages",
+			modules: []testModule{
+				{name: "slow", stage: StageServer, delay: time.Second},
+				{name: "log", stage: StageLog},
+			},
+			timeout:  20 * time.Millisecond,
+			want:     []string{"slow:100", "log:300"},
+			wantErr:  []string{"slow", "log"},
+			timedOut: []string{"slow", "log"},
+		},
+	}
+
+	for _, tt := range tests {
+		InitExitList()
+		el := GetExitList()
+		el.SetModuleTimeout(tt.moduleTimeout)
+		rec := &stopRecorder{}
+		for i := range tt.modules {
+			m := &tt.modules[i]
+			m.rec = rec
+			if m.stage == 0 {
+				// StageDefault, without StageInterface
+				if err := el.Register(struct{ ExitInterface }{m}); err != nil {
+					t.Fatal(err)
+				}
+				m.stage = StageDefault
+				continue
+			}
+			if err := el.Register(m); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ctx := context.Background()
+		if tt.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+			defer cancel()
+		}
+
+		begin := time.Now()
+		report, err := el.Stop(ctx)
+		if took := time.Since(begin); took > 500*time.Millisecond {
+			t.Errorf("%s: Stop took %s", tt.name, took)
+		}
+
+		var got, gotErr, gotTimedOut []string
+		for _, m := range report.Modules {
+			got = append(got, m.Name+":"+strconv.Itoa(m.Stage))
+			if m.Err != nil {
+				gotErr = append(gotErr, m.Name)
+			}
+			if m.TimedOut {
+				gotTimedOut = append(gotTimedOut, m.Name)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: report = %v, want %v", tt.name, got, tt.want)
+		}
+		if strings.Join(gotErr, ",") != strings.Join(tt.wantErr, ",") {
+			t.Errorf("%s: failed modules = %v, want %v", tt.name, gotErr, tt.wantErr)
+		}
+		if strings.Join(gotTimedOut, ",") != strings.Join(tt.timedOut, ",") {
+			t.Errorf("%s: timed out modules = %v, want %v", tt.name, gotTimedOut, tt.timedOut)
+		}
+		if (err == nil) != (len(tt.wantErr) == 0) || len(report.Failed()) != len(tt.wantErr) {
+			t.Errorf("%s: Stop error = %v, Failed() = %v", tt.name, err, report.Failed())
+		}
+		for _, name := range tt.wantErr {
+			if err != nil && !strings.Contains(err.Error(), "module("+name+")") {
+				t.Errorf("%s: Stop error = %v, want %s in it", tt.name, err, name)
+			}
+		}
+	}
+}
+
+func TestExitListStopStageConcurrently(t *testing.T) {
+	InitExitList()
+	el := GetExitList()
+	el.SetModuleTimeout(time.Second)
+
+	// Every module of the stage waits for the others to begin stopping
+	var barrier sync.WaitGroup
+	barrier.Add(3)
+	for _, name := range []string{"a", "b", "c"} {
+		el.Register(&barrierModule{name: name, barrier: &barrier})
+	}
+
+	report, err := el.Stop(context.Background())
+	if err != nil {
+		t.Fatalf("Stop error = %v, the modules of a stage did not stop concurrently", err)
+	}
+	for _, m := range report.Modules {
+		if m.Duration >= time.Second {
+			t.Errorf("%s took %s", m.Name, m.Duration)
+		}
+	}
+}
+
+func TestExitListContextStopper(t *testing.T) {
+	InitExitList()
+	el := GetExitList()
+	el.SetModuleTimeout(20 * time.Millisecond)
+
+	rec := &stopRecorder{}
+	el.Register(&contextModule{testModule{name: "slow", stage: StageServer, delay: time.Second, rec: rec}})
+	el.Register(&contextModule{testModule{name: "fast", stage: StageServer, rec: rec}})
+
+	report, _ := el.Stop(context.Background())
+	slow, fast := report.Modules[0], report.Modules[1]
+	if !slow.TimedOut || !errors.Is(slow.Err, context.DeadlineExceeded) {
+		t.Errorf("slow = %+v, want timed out", slow)
+	}
+	if fast.TimedOut || fast.Err != nil {
+		t.Errorf("fast = %+v, want stopped", fast)
+	}
+}
+
+func TestExitListRegister(t *testing.T) {
+	InitExitList()
+	el := GetExitList()
+	rec := &stopRecorder{}
+
+	if err := el.Register(&testModule{name: "a", stage: StageServer, rec: rec}); err != nil {
+		t.Fatal(err)
+	}
+	if err := el.Register(&testModule{name: "a", stage: StageLog, rec: rec}); err == nil {
+		t.Error("Register succeeded with a taken name")
+	}
+	if err := el.RegisterStage(&testModule{name: "b", stage: StageServer, rec: rec}, StageConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	report, _ := el.Stop(context.Background())
+	if len(report.Modules) != 2 || report.Modules[1].Name != "b" || report.Modules[1].Stage != StageConfig {
+		t.Errorf("report = %+v, want b in StageConfig", report.Modules)
+	}
+
+	// Stop takes the modules, they are not stopped twice
+	if report, _ := el.Stop(context.Background()); len(report.Modules) != 0 {
+		t.Errorf("second Stop report = %+v", report.Modules)
+	}
+}
+
+type barrierModule struct {
+	name    string
+	barrier *sync.WaitGroup
+}
+
+func (m *barrierModule) GetModuleName() string {
+	return m.name
+}
+
+func (m *barrierModule) Stop() error {
+	m.barrier.Done()
+	m.barrier.Wait()
+	return nil
+}
@@ -0,0 +1,197 @@
+package graceful
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Environment passed to the new process by Restart. The names are not under the
+// LILGO_ prefix of configure, so they are not read as configuration.
+const (
+	// Names of the inherited listeners joined by ":", the i-th is fd 3+i
+	EnvInheritListeners = "_LILGO_INHERIT_LISTENERS"
+
+	// Pid of the old process, stopped by NotifyParent
+	EnvParentPid = "_LILGO_PARENT_PID"
+)
+
+// First fd of exec.Cmd.ExtraFiles
+const inheritFdStart = 3
+
+var (
+	listenersMu sync.Mutex
+	// Listeners passed to the new process on restart, name => listener
+	listeners = make(map[string]net.Listener)
+	// Listeners passed by the old process, name => listener
+	inherited map[string]net.Listener
+	// Listeners passed by the old process which can not be used, name => error
+	inheritErrs   map[string]error
+	inheritedOnce sync.Once
+
+	restarting bool
+)
+
+// Listener which can be passed to another process
+type fileListener interface {
+	net.Listener
+	File() (*os.File, error)
+}
+
+// RegisterListener registers a listener to be passed to the new process on restart.
+func RegisterListener(name string, l net.Listener) error {
+	if _, ok := l.(fileListener); !ok {
+		return fmt.Errorf("[Restart] RegisterListener: %T of %s can not be passed", l, name)
+	}
+
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	if _, ok := listeners[name]; ok {
+		return errors.New("[Restart] RegisterListener: this listener(" + name + ") name is exist")
+	}
+	listeners[name] = l
+	return nil
+}
+
+// InheritedListener returns the listener called name passed by the old process,
+// or nil when this process was not started by Restart. An error is returned when
+// the passed descriptor is not a listener.
+func InheritedListener(name string) (net.Listener, error) {
+	inheritedOnce.Do(parseInherited)
+
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	if err, ok := inheritErrs[name]; ok {
+		delete(inheritErrs, name)
+		return nil, err
+	}
+	l := inherited[name]
+	delete(inherited, name)
+	return l, nil
+}
+
+// Wrap the descriptors passed by the old process
+func parseInherited() {
+	inherited = make(map[string]net.Listener)
+	inheritErrs = make(map[string]error)
+
+	value := os.Getenv(EnvInheritListeners)
+	os.Unsetenv(EnvInheritListeners)
+	if value == "" {
+		return
+	}
+
+	for i, name := range strings.Split(value, ":") {
+		fd := inheritFdStart + i
+		syscall.CloseOnExec(fd)
+
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		// FileListener dups the descriptor
+		f.Close()
+		if err != nil {
+			inheritErrs[name] = fmt.Errorf("[Restart] inherit listener %s(fd %d) error : %s", name, fd, err)
+			continue
+		}
+		inherited[name] = l
+	}
+}
+
+// Restart starts the executable again with the same arguments and passes it the
+// registered listeners. The old process keeps serving until the new one calls
+// NotifyParent, which sends it SIGTERM. onExit, if not nil, is called when the new
+// process exits while this one is still running, e.g. it failed to start.
+func Restart(onExit func(pid int, err error)) (int, error) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+
+	if restarting {
+		return 0, errors.New("[Restart] Restart: already restarting")
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	names := make([]string, 0, len(listeners))
+	files := make([]*os.File, 0, len(listeners))
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for name, l := range listeners {
+		f, err := l.(fileListener).File()
+		if err != nil {
+			return 0, fmt.Errorf("[Restart] Restart: listener(%s) %s", name, err)
+		}
+		names = append(names, name)
+		files = append(files, f)
+	}
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(),
+		EnvInheritListeners+"="+strings.Join(names, ":"),
+		EnvParentPid+"="+strconv.Itoa(os.Getpid()),
+	)
+
+	if err = cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	// The socket file of a unix listener belongs to the new process now
+	for _, l := range listeners {
+		if ul, ok := l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+
+	restarting = true
+	go func() {
+		// Reap the new process if it fails before taking over
+		err := cmd.Wait()
+		listenersMu.Lock()
+		restarting = false
+		listenersMu.Unlock()
+		if onExit != nil {
+			onExit(cmd.Process.Pid, err)
+		}
+	}()
+
+	return cmd.Process.Pid, nil
+}
+
+// NotifyParent tells the old process that this one is serving, so it stops.
+// It does nothing when this process was not started by Restart.
+func NotifyParent() error {
+	value := os.Getenv(EnvParentPid)
+	os.Unsetenv(EnvParentPid)
+	if value == "" {
+		return nil
+	}
+
+	pid, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+
+	// The old process may be gone already
+	if pid != os.Getppid() {
+		return errors.New("[Restart] NotifyParent: parent process(" + value + ") is gone")
+	}
+
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
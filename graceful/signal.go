@@ -0,0 +1,171 @@
+package graceful
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var signalManager *SignalManager
+
+// SignalHandler handles a received signal.
+type SignalHandler func(sig os.Signal)
+
+// SignalManager dispatches signals to the registered handlers until a stop
+// signal (SIGINT, SIGTERM, SIGQUIT) is received.
+type SignalManager struct {
+	mu       sync.RWMutex
+	handlers map[os.Signal][]SignalHandler
+	sigChan  chan os.Signal
+
+	// Deadline of ExitList.Stop, modules still stopping are abandoned
+	stopTimeout time.Duration
+}
+
+// Signals received while a handler runs are queued, the ones beyond are dropped
+const signalQueueSize = 16
+
+// Signals which stop the program
+var stopSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+
+// Initialize signal manager
+func InitSignalManager(stopTimeout time.Duration) {
+	signalManager = &SignalManager{
+		handlers:    make(map[os.Signal][]SignalHandler),
+		sigChan:     make(chan os.Signal, signalQueueSize),
+		stopTimeout: stopTimeout,
+	}
+	signal.Notify(signalManager.sigChan, stopSignals...)
+}
+
+// Get a signalManager instance
+func GetSignalManager() *SignalManager {
+	return signalManager
+}
+
+// Handle registers a handler for the signal. Handlers of the same signal run in
+// registration order, in the goroutine of Run.
+func (sm *SignalManager) Handle(sig os.Signal, h SignalHandler) error {
+	for _, s := range stopSignals {
+		if s == sig {
+			return errors.New("[Signal] Handle: " + sig.String() + " is a stop signal")
+		}
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, ok := sm.handlers[sig]; !ok {
+		signal.Notify(sm.sigChan, sig)
+	}
+	sm.handlers[sig] = append(sm.handlers[sig], h)
+
+	return nil
+}
+
+// Run dispatches signals until a stop signal, then stops the exit list and
+// returns how every module stopped. A second SIGINT during the stop exits
+// immediately.
+func (sm *SignalManager) Run() (*StopReport, error) {
+	for sig := range sm.sigChan {
+		if isStopSignal(sig) {
+			return sm.stop(sig)
+		}
+
+		sm.mu.RLock()
+		handlers := sm.handlers[sig]
+		sm.mu.RUnlock()
+
+		for _, h := range handlers {
+			h(sig)
+		}
+	}
+
+	return nil, nil
+}
+
+func (sm *SignalManager) stop(sig os.Signal) (*StopReport, error) {
+	ctx := context.Background()
+	if sm.stopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sm.stopTimeout)
+		defer cancel()
+	}
+
+	done := make(chan *StopReport, 1)
+	go func() {
+		report, _ := GetExitList().Stop(ctx)
+		done <- report
+	}()
+
+	for {
+		select {
+		case report := <-done:
+			return report, report.Err()
+		case s := <-sm.sigChan:
+			if s == syscall.SIGINT {
+				fmt.Printf("[Signal] received %s again during stop(%s), force exit\n", s, sig)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+func isStopSignal(sig os.Signal) bool {
+	for _, s := range stopSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// GoroutineStacks returns the stack traces of all goroutines.
+func GoroutineStacks() []byte {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// ParseSignal returns the signal called name, like SIGUSR2 or USR2.
+func ParseSignal(name string) (os.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	switch name {
+	case "SIGHUP":
+		return syscall.SIGHUP, nil
+	case "SIGUSR1":
+		return syscall.SIGUSR1, nil
+	case "SIGUSR2":
+		return syscall.SIGUSR2, nil
+	case "SIGINT":
+		return syscall.SIGINT, nil
+	case "SIGQUIT":
+		return syscall.SIGQUIT, nil
+	case "SIGTERM":
+		return syscall.SIGTERM, nil
+	case "SIGTTIN":
+		return syscall.SIGTTIN, nil
+	case "SIGTTOU":
+		return syscall.SIGTTOU, nil
+	case "SIGWINCH":
+		return syscall.SIGWINCH, nil
+	default:
+		return nil, errors.New("unknown signal " + name)
+	}
+}
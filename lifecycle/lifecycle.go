@@ -0,0 +1,272 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xxlixin1993/LiLGo/graceful"
+	"strings"
+	"sync"
+)
+
+// Module is a part of the program which can be started and stopped.
+type Module interface {
+	// get module name
+	GetModuleName() string
+
+	// Start the module, it should return once the module is ready and not
+	// block while serving.
+	Start(ctx context.Context) error
+
+	// Stop the module before ctx is done
+	Stop(ctx context.Context) error
+}
+
+// Lifecycle starts the modules in dependency order and stops them in reverse.
+type Lifecycle struct {
+	mu sync.Mutex
+
+	// module list, in registration order
+	modules []*lifecycleModule
+
+	// module name map
+	module map[string]*lifecycleModule
+
+	// Started modules, in start order
+	started []*lifecycleModule
+}
+
+// Stops a started module through the ExitList
+type exitModule struct {
+	m     Module
+	stage int
+}
+
+type lifecycleModule struct {
+	Module
+	dependsOn []string
+}
+
+// StartError is returned by Start when a module failed to start.
+type StartError struct {
+	// Name of the failed module, empty when the dependencies are wrong
+	Module string
+	Err    error
+	// Error of stopping the already started modules
+	RollbackErr error
+}
+
+// Returns a instance of *Lifecycle
+func New() *Lifecycle {
+	return &Lifecycle{
+		module: make(map[string]*lifecycleModule),
+	}
+}
+
+// Register adds a module which is started after the modules named by dependsOn.
+// Modules without dependencies between them are started in registration order.
+func (lc *Lifecycle) Register(m Module, dependsOn ...string) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	moduleName := m.GetModuleName()
+	if _, ok := lc.module[moduleName]; ok {
+		return errors.New("[Lifecycle] Register: this module(" + moduleName + ") name is exist")
+	}
+
+	lm := &lifecycleModule{Module: m, dependsOn: dependsOn}
+	lc.modules = append(lc.modules, lm)
+	lc.module[moduleName] = lm
+
+	return nil
+}
+
+// Start the registered modules one by one
+// When a module fails, the modules started before it are stopped in reverse
+// order within ctx and a *StartError is returned.
+func (lc *Lifecycle) Start(ctx context.Context) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if len(lc.started) != 0 {
+		return errors.New("[Lifecycle] Start: already started")
+	}
+
+	order, err := lc.sort()
+	if err != nil {
+		return &StartError{Err: err}
+	}
+
+	for _, m := range order {
+		err := ctx.Err()
+		if err == nil {
+			err = m.Start(ctx)
+		}
+		if err != nil {
+			return &StartError{
+				Module:      m.GetModuleName(),
+				Err:         err,
+				RollbackErr: lc.stop(ctx),
+			}
+		}
+		lc.started = append(lc.started, m)
+	}
+
+	return nil
+}
+
+// Stop the started modules in reverse start order
+// Every module is stopped even if one fails, the errors are joined.
+func (lc *Lifecycle) Stop(ctx context.Context) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	return lc.stop(ctx)
+}
+
+// RegisterExit hands the started modules over to el, so that every module gets
+// its own timeout and report on exit. A module declares its stop stage by
+// implementing StageInterface, otherwise it is StageDefault. A module whose stage
+// is not after the stages of the modules depending on it is moved to the stage
+// after them, as modules of the same stage are stopped concurrently. The modules
+// handed over are not stopped by lc anymore.
+func (lc *Lifecycle) RegisterExit(el *graceful.ExitList) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	// Dependents are started later, so walk backwards
+	stages := make(map[string]int, len(lc.started))
+	for i := len(lc.started) - 1; i >= 0; i-- {
+		m := lc.started[i]
+		stage := graceful.StageDefault
+		if si, ok := m.Module.(graceful.StageInterface); ok {
+			stage = si.GetStopStage()
+		}
+		for _, d := range lc.started[i+1:] {
+			for _, dep := range d.dependsOn {
+				if dep == m.GetModuleName() && stages[d.GetModuleName()] >= stage {
+					stage = stages[d.GetModuleName()] + 1
+				}
+			}
+		}
+		stages[m.GetModuleName()] = stage
+	}
+
+	var kept []*lifecycleModule
+	var errInfo []string
+	for _, m := range lc.started {
+		em := exitModule{m: m.Module, stage: stages[m.GetModuleName()]}
+		if err := el.Register(em); err != nil {
+			kept = append(kept, m)
+			errInfo = append(errInfo, err.Error())
+		}
+	}
+	lc.started = kept
+
+	if len(errInfo) != 0 {
+		return errors.New(strings.Join(errInfo, "\n"))
+	}
+	return nil
+}
+
+// Stop the started modules, lc.mu is held
+func (lc *Lifecycle) stop(ctx context.Context) error {
+	var errInfo []string
+	for i := len(lc.started) - 1; i >= 0; i-- {
+		m := lc.started[i]
+		if err := m.Stop(ctx); err != nil {
+			errInfo = append(errInfo, "[Lifecycle]: Stop this module("+m.GetModuleName()+") "+err.Error())
+		}
+	}
+	lc.started = nil
+
+	if len(errInfo) != 0 {
+		return errors.New(strings.Join(errInfo, "\n"))
+	}
+	return nil
+}
+
+// Sort the modules so that every module comes after its dependencies
+func (lc *Lifecycle) sort() ([]*lifecycleModule, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int, len(lc.modules))
+	order := make([]*lifecycleModule, 0, len(lc.modules))
+
+	var visit func(m *lifecycleModule, path []string) error
+	visit = func(m *lifecycleModule, path []string) error {
+		name := m.GetModuleName()
+		path = append(path, name)
+
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle %s", strings.Join(path, " -> "))
+		}
+
+		state[name] = visiting
+		for _, dep := range m.dependsOn {
+			dm, ok := lc.module[dep]
+			if !ok {
+				return fmt.Errorf("module(%s) depends on unknown module(%s)", name, dep)
+			}
+			if err := visit(dm, path); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		order = append(order, m)
+
+		return nil
+	}
+
+	for _, m := range lc.modules {
+		if err := visit(m, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+// Implement ExitInterface
+func (em exitModule) GetModuleName() string {
+	return em.m.GetModuleName()
+}
+
+// Implement ExitInterface
+func (em exitModule) Stop() error {
+	return em.m.Stop(context.Background())
+}
+
+// Implement ContextStopper
+func (em exitModule) StopContext(ctx context.Context) error {
+	return em.m.Stop(ctx)
+}
+
+// Implement StageInterface
+func (em exitModule) GetStopStage() int {
+	return em.stage
+}
+
+func (se *StartError) Error() string {
+	var msg string
+	if se.Module == "" {
+		msg = "[Lifecycle] Start: " + se.Err.Error()
+	} else {
+		msg = "[Lifecycle] Start this module(" + se.Module + ") " + se.Err.Error()
+	}
+	if se.RollbackErr != nil {
+		msg += "\n" + se.RollbackErr.Error()
+	}
+	return msg
+}
+
+func (se *StartError) Unwrap() error {
+	return se.Err
+}
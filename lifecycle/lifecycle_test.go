@@ -0,0 +1,286 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"github.com/xxlixin1993/LiLGo/graceful"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Records the start and stop of the modules
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+type testModule struct {
+	name     string
+	startErr error
+	stopErr  error
+	rec      *recorder
+}
+
+func (m *testModule) GetModuleName() string {
+	return m.name
+}
+
+func (m *testModule) Start(ctx context.Context) error {
+	if m.startErr != nil {
+		return m.startErr
+	}
+	m.rec.add("start " + m.name)
+	return nil
+}
+
+func (m *testModule) Stop(ctx context.Context) error {
+	m.rec.add("stop " + m.name)
+	return m.stopErr
+}
+
+// A module which declares its stop stage
+type stageModule struct {
+	testModule
+	stage int
+}
+
+func (m *stageModule) GetStopStage() int {
+	return m.stage
+}
+
+type moduleSpec struct {
+	name      string
+	stage     int
+	dependsOn []string
+}
+
+func TestRegisterExitStages(t *testing.T) {
+	tests := []struct {
+		name    string
+		modules []moduleSpec
+		// Name:stage in stop order
+		want []string
+	}{
+		{
+			name: "declared stages",
+			modules: []moduleSpec{
+				{"config", graceful.StageConfig, nil},
+				{"log", graceful.StageLog, []string{"config"}},
+				{"http", graceful.StageServer, []string{"log", "config"}},
+			},
+			want: []string{"http:100", "log:300", "config:400"},
+		},
+		{
+			name: "default stages are bumped after the dependents",
+			modules: []moduleSpec{
+				{"config", 0, nil},
+				{"log", 0, []string{"config"}},
+				{"http", 0, []string{"log"}},
+			},
+			want: []string{"http:200", "log:201", "config:202"},
+		},
+		{
+			name: "dependency declaring an earlier stage",
+			modules: []moduleSpec{
+				{"cache", graceful.StageServer, nil},
+				{"worker", 0, []string{"cache"}},
+			},
+			want: []string{"worker:200", "cache:201"},
+		},
+		{
+			name: "bumped over the latest dependent",
+			modules: []moduleSpec{
+				{"db", 0, nil},
+				{"http", graceful.StageServer, []string{"db"}},
+				{"log", graceful.StageLog, []string{"db"}},
+			},
+			want: []string{"http:100", "log:300", "db:301"},
+		},
+		{
+			name: "independent modules share a stage",
+			modules: []moduleSpec{
+				{"a", 0, nil},
+				{"b", 0, nil},
+			},
+			want: []string{"a:200", "b:200"},
+		},
+	}
+
+	for _, tt := range tests {
+		rec := &recorder{}
+		lc := New()
+		for _, spec := range tt.modules {
+			tm := testModule{name: spec.name, rec: rec}
+			var m Module = &tm
+			if spec.stage != 0 {
+				m = &stageModule{testModule: tm, stage: spec.stage}
+			}
+			if err := lc.Register(m, spec.dependsOn...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := lc.Start(context.Background()); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		graceful.InitExitList()
+		el := graceful.GetExitList()
+		if err := lc.RegisterExit(el); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		// Handed over, lc does not stop them anymore
+		if err := lc.Stop(context.Background()); err != nil || len(rec.events) != len(tt.modules) {
+			t.Errorf("%s: Lifecycle.Stop after RegisterExit = %v, events %v", tt.name, err, rec.events)
+		}
+
+		report, err := el.Stop(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, m := range report.Modules {
+			got = append(got, m.Name+":"+strconv.Itoa(m.Stage))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: stop order = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterExitNameTaken(t *testing.T) {
+	rec := &recorder{}
+	lc := New()
+	lc.Register(&testModule{name: "a", rec: rec})
+	lc.Register(&testModule{name: "b", rec: rec})
+	if err := lc.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	graceful.InitExitList()
+	el := graceful.GetExitList()
+	el.Register(exitModule{m: &testModule{name: "a", rec: rec}})
+
+	if err := lc.RegisterExit(el); err == nil {
+		t.Error("RegisterExit succeeded with a taken name")
+	}
+
+	// The module which could not be handed over is still stopped by lc
+	if err := lc.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"start a", "start b", "stop a"}; !reflect.DeepEqual(rec.events, want) {
+		t.Errorf("events = %v, want %v", rec.events, want)
+	}
+}
+
+func TestStartRollback(t *testing.T) {
+	boom := errors.New("boom")
+
+	tests := []struct {
+		name        string
+		modules     []*testModule
+		dependsOn   [][]string
+		wantModule  string
+		wantEvents  []string
+		rollbackErr string
+	}{
+		{
+			name: "started modules are stopped in reverse order",
+			modules: []*testModule{
+				{name: "config"},
+				{name: "log"},
+				{name: "http", startErr: boom},
+			},
+			dependsOn:  [][]string{nil, {"config"}, {"log"}},
+			wantModule: "http",
+			wantEvents: []string{"start config", "start log", "stop log", "stop config"},
+		},
+		{
+			name: "every module is stopped when one fails to stop",
+			modules: []*testModule{
+				{name: "config", stopErr: errors.New("stuck")},
+				{name: "log"},
+				{name: "http", startErr: boom},
+			},
+			dependsOn:   [][]string{nil, {"config"}, {"log"}},
+			wantModule:  "http",
+			wantEvents:  []string{"start config", "start log", "stop log", "stop config"},
+			rollbackErr: "module(config) stuck",
+		},
+		{
+			name: "first module fails",
+			modules: []*testModule{
+				{name: "config", startErr: boom},
+				{name: "log"},
+			},
+			dependsOn:  [][]string{nil, {"config"}},
+			wantModule: "config",
+		},
+	}
+
+	for _, tt := range tests {
+		rec := &recorder{}
+		lc := New()
+		for i, m := range tt.modules {
+			m.rec = rec
+			lc.Register(m, tt.dependsOn[i]...)
+		}
+
+		err := lc.Start(context.Background())
+		var se *StartError
+		if !errors.As(err, &se) || se.Module != tt.wantModule || !errors.Is(err, boom) {
+			t.Errorf("%s: Start error = %v, want the failure of %s", tt.name, err, tt.wantModule)
+			continue
+		}
+		if !reflect.DeepEqual(rec.events, tt.wantEvents) {
+			t.Errorf("%s: events = %v, want %v", tt.name, rec.events, tt.wantEvents)
+		}
+		if tt.rollbackErr == "" && se.RollbackErr != nil || tt.rollbackErr != "" &&
+			(se.RollbackErr == nil || !strings.Contains(se.RollbackErr.Error(), tt.rollbackErr)) {
+			t.Errorf("%s: RollbackErr = %v, want %q", tt.name, se.RollbackErr, tt.rollbackErr)
+		}
+
+		// Nothing is left to stop
+		if err := lc.Stop(context.Background()); err != nil || len(rec.events) != len(tt.wantEvents) {
+			t.Errorf("%s: Stop after rollback = %v, events %v", tt.name, err, rec.events)
+		}
+	}
+}
+
+func TestStartDependencyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		dependsOn map[string][]string
+		want      string
+	}{
+		{"cycle", map[string][]string{"a": {"b"}, "b": {"a"}}, "dependency cycle"},
+		{"unknown", map[string][]string{"a": {"x"}}, "unknown module(x)"},
+	}
+
+	for _, tt := range tests {
+		rec := &recorder{}
+		lc := New()
+		for _, name := range []string{"a", "b"} {
+			lc.Register(&testModule{name: name, rec: rec}, tt.dependsOn[name]...)
+		}
+
+		err := lc.Start(context.Background())
+		var se *StartError
+		if !errors.As(err, &se) || se.Module != "" || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Start error = %v, want %q", tt.name, err, tt.want)
+		}
+		if len(rec.events) != 0 {
+			t.Errorf("%s: modules started: %v", tt.name, rec.events)
+		}
+	}
+}
@@ -18,8 +18,8 @@ var (
 )
 
 const (
-	// 每隔多久刷新一次日志 单位秒
-	flushInterval = 10
+	// 每隔多久刷新一次日志
+	flushInterval = 10 * time.Second
 
 	// 默认日志路径
 	defaultLogDir = "/tmp"
@@ -38,16 +38,19 @@ type LogFile struct {
 	LogDir        string
 	MaxSize       uint64
 	BufferSize    int
-	FlushInterval uint64
+	FlushInterval time.Duration
 	nBytes        uint64
 }
 
 func NewFileLog() ILog {
 	logFile := &LogFile{
 		LogDir:        configure.DefaultString("log.dir", defaultLogDir),
-		FlushInterval: uint64(configure.DefaultInt("log.flush_interval", flushInterval)),
-		MaxSize:       uint64(configure.DefaultInt("log.max_size", maxSize)),
-		BufferSize:    configure.DefaultInt("log.buffer_size", bufferSize),
+		FlushInterval: configure.DefaultDuration("log.flush_interval", flushInterval),
+		MaxSize:       uint64(configure.DefaultBytes("log.max_size", maxSize)),
+		BufferSize:    int(configure.DefaultBytes("log.buffer_size", bufferSize)),
+	}
+	if logFile.FlushInterval <= 0 {
+		logFile.FlushInterval = flushInterval
 	}
 
 	go logFile.flushDaemon()
@@ -69,6 +72,7 @@ func (f *LogFile) OutputLogMsg(msg []byte) error {
 		// When the buffer upper limit is reached, create a new file to write to avoid missing
 		// Consider changing the configuration log.max_size when this happens
 		if err = f.BeginLog(time.Now()); err != nil {
+			f.mu.Unlock()
 			return err
 		}
 	}
@@ -83,6 +87,13 @@ func (f *LogFile) Flush() {
 	f.lockAndFlushAll()
 }
 
+// Flush the current file and continue in a new one
+func (f *LogFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.BeginLog(time.Now())
+}
+
 // Create a log file
 func (f *LogFile) create(t time.Time) (osFile *os.File, filename string, err error) {
 	fName := filepath.Join(f.LogDir, f.getName(t))
@@ -95,9 +106,10 @@ func (f *LogFile) create(t time.Time) (osFile *os.File, filename string, err err
 }
 
 // Begin log goroutine
+// The caller must hold f.mu once the log is running
 func (f *LogFile) BeginLog(now time.Time) error {
 	if f.logFile != nil {
-		f.Flush()
+		f.flushAll()
 		f.logFile.Close()
 	}
 
@@ -152,7 +164,7 @@ func (f *LogFile) flushAll() {
 
 // Timed write the data of the buffer to the file
 func (f *LogFile) flushDaemon() {
-	for range time.NewTicker(time.Duration(f.FlushInterval) * time.Second).C {
+	for range time.NewTicker(f.FlushInterval).C {
 		f.lockAndFlushAll()
 	}
 }
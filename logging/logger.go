@@ -46,6 +46,9 @@ type ILog interface {
 	OutputLogMsg(msg []byte) error
 
 	Flush()
+
+	// Reopen the output, e.g. after the log file was rotated
+	Reopen() error
 }
 
 // Log core program
@@ -56,6 +59,8 @@ type LogBase struct {
 	message chan []byte
 	skip    int
 	level   int
+	// Set by Stop, messages are then written directly to the handle
+	stopped bool
 }
 
 // Implement ExitInterface
@@ -64,28 +69,74 @@ func (l *LogBase) GetModuleName() string {
 }
 
 // Implement ExitInterface
+// A module abandoned by the ExitList may still log afterwards, see Output.
 func (l *LogBase) Stop() error {
-	close(loggerInstance.message)
-	loggerInstance.Wait()
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		return nil
+	}
+	l.stopped = true
+	close(l.message)
+	l.mu.Unlock()
+
+	l.Wait()
 	return nil
 }
 
+// Implement StageInterface
+func (l *LogBase) GetStopStage() int {
+	return graceful.StageLog
+}
+
 // Initialize Log
 func InitLog() error {
+	logger, err := startLog()
+	if err != nil {
+		return err
+	}
+
+	graceful.GetExitList().Register(logger)
+
+	return nil
+}
+
+// Create the logger from app.ini and start it
+func startLog() (*LogBase, error) {
 	outputType := configure.DefaultString("log.output", OutputStdout)
 	level := configure.DefaultInt("log.level", LevelDebug)
 
 	logger, err := createLogger(outputType, level)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	logger.handle.Init()
-	graceful.GetExitList().Pop(logger)
+	if err := logger.handle.Init(); err != nil {
+		return nil, err
+	}
 
 	go logger.Run()
 
-	return err
+	// Follow log.level of the reloaded configure
+	configure.AddValidator(validateLevel)
+	configure.Watch("log.level", func(old, new string) {
+		level := configure.DefaultInt("log.level", LevelDebug)
+		logger.SetLevel(level)
+		NoticeF("log: level %s -> %d", old, level)
+	})
+
+	return logger, nil
+}
+
+// Check log.level of the reloaded configure
+func validateLevel(next *configure.Config) error {
+	if next.String("log.level") == "" {
+		return nil
+	}
+	if _, err := next.Int("log.level"); err != nil {
+		return fmt.Errorf("log.level: %v", err)
+	}
+	return nil
 }
 
 // Create Logger instance
@@ -117,9 +168,14 @@ func GetLogger() *LogBase {
 	return loggerInstance
 }
 
+// Reopen the log output
+func Reopen() error {
+	return GetLogger().handle.Reopen()
+}
+
 // Start log, receive information, wait information
 func (l *LogBase) Run() {
-	loggerInstance.Add(1)
+	l.Add(1)
 
 	for {
 		msg, ok := <-l.message
@@ -136,25 +192,46 @@ func (l *LogBase) Run() {
 }
 
 // Output message
+// After Stop the message is written directly, so a module which missed its stop
+// timeout can still log.
 func (l *LogBase) Output(nowLevel int, msg string) {
 	now := utils.GetMicTimeFormat()
 
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if nowLevel <= l.level {
-		_, file, line, ok := runtime.Caller(l.skip)
-		if !ok {
-			file = "???"
-			line = 0
+	if nowLevel > l.level {
+		return
+	}
+
+	_, file, line, ok := runtime.Caller(l.skip)
+	if !ok {
+		file = "???"
+		line = 0
+	}
+	_, filename := path.Split(file)
+	msg = fmt.Sprintf("[%s] [%s %s:%d] %s\n", LevelName[nowLevel], now, filename, line, msg)
+
+	if l.stopped {
+		// Write it after the queued messages
+		l.Wait()
+		if err := l.handle.OutputLogMsg([]byte(msg)); err != nil {
+			fmt.Printf("Log: Output handle fail, err:%v\n", err.Error())
 		}
-		_, filename := path.Split(file)
-		msg = fmt.Sprintf("[%s] [%s %s:%d] %s\n", LevelName[nowLevel], now, filename, line, msg)
+		l.handle.Flush()
+		return
 	}
 
 	l.message <- []byte(msg)
 }
 
+// SetLevel changes the max level of the output messages.
+func (l *LogBase) SetLevel(level int) {
+	l.mu.Lock()
+	l.level = level
+	l.mu.Unlock()
+}
+
 func Debug(args ...interface{}) {
 	msg := fmt.Sprint(args...)
 	GetLogger().Output(LevelDebug, msg)
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"context"
+	"github.com/xxlixin1993/LiLGo/graceful"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Keeps the output messages
+type memoryLog struct {
+	mu       sync.Mutex
+	messages []string
+	output   chan struct{}
+}
+
+func (m *memoryLog) Init() error {
+	return nil
+}
+
+func (m *memoryLog) OutputLogMsg(msg []byte) error {
+	m.mu.Lock()
+	m.messages = append(m.messages, string(msg))
+	m.mu.Unlock()
+	m.output <- struct{}{}
+	return nil
+}
+
+func (m *memoryLog) Flush() {}
+
+func (m *memoryLog) Reopen() error {
+	return nil
+}
+
+func (m *memoryLog) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return strings.Join(m.messages, "")
+}
+
+// Does not stop within the module timeout and logs when it finally does
+type slowModule struct {
+	logger  *LogBase
+	release chan struct{}
+	stopped chan struct{}
+}
+
+func (s *slowModule) GetModuleName() string {
+	return "slowModule"
+}
+
+func (s *slowModule) Stop() error {
+	<-s.release
+	s.logger.Output(LevelNotice, "slow module stopped")
+	close(s.stopped)
+	return nil
+}
+
+func TestLogAfterStopTimeout(t *testing.T) {
+	handle := &memoryLog{output: make(chan struct{}, 10)}
+	logger := &LogBase{
+		handle:  handle,
+		message: make(chan []byte, 10),
+		skip:    2,
+		level:   LevelDebug,
+	}
+	go logger.Run()
+	logger.Output(LevelInfo, "running")
+	<-handle.output
+
+	graceful.InitExitList()
+	el := graceful.GetExitList()
+	el.SetModuleTimeout(20 * time.Millisecond)
+
+	slow := &slowModule{logger: logger, release: make(chan struct{}), stopped: make(chan struct{})}
+	if err := el.Register(slow); err != nil {
+		t.Fatal(err)
+	}
+	if err := el.Register(logger); err != nil {
+		t.Fatal(err)
+	}
+
+	report, _ := el.Stop(context.Background())
+	if len(report.Modules) != 2 || !report.Modules[0].TimedOut || report.Modules[1].Err != nil {
+		t.Fatalf("report = %+v, want the slow module timed out and the log stopped", report.Modules)
+	}
+
+	close(slow.release)
+	select {
+	case <-slow.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the slow module did not return")
+	}
+
+	if got := handle.String(); !strings.Contains(got, "running") || !strings.Contains(got, "slow module stopped") {
+		t.Errorf("output = %q, want both messages", got)
+	}
+
+	// Stopping again is a no-op
+	if err := logger.Stop(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"context"
+	"github.com/xxlixin1993/LiLGo/graceful"
+)
+
+// Module runs the log as a lifecycle module. Unlike InitLog it does not register
+// itself to the ExitList: the lifecycle stops it when a later module fails to
+// start, otherwise Lifecycle.RegisterExit hands it over to the ExitList, which
+// stops it in StageLog after the modules depending on it.
+type Module struct {
+	logger *LogBase
+}
+
+// Returns a instance of *Module
+func NewModule() *Module {
+	return &Module{}
+}
+
+// Implement lifecycle.Module
+func (m *Module) GetModuleName() string {
+	return LogModuleName
+}
+
+// Implement lifecycle.Module
+func (m *Module) Start(ctx context.Context) error {
+	logger, err := startLog()
+	if err != nil {
+		return err
+	}
+	m.logger = logger
+
+	return nil
+}
+
+// Implement lifecycle.Module
+// The messages still queued are flushed unless ctx is done first.
+func (m *Module) Stop(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- m.logger.Stop()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Implement StageInterface
+func (m *Module) GetStopStage() int {
+	return graceful.StageLog
+}
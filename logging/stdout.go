@@ -24,3 +24,8 @@ func (s *LogStdout) OutputLogMsg(msg []byte) error {
 func (s *LogStdout) Flush() {
 
 }
+
+// Nothing to reopen for stdout
+func (s *LogStdout) Reopen() error {
+	return nil
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Struct tags used by DefaultBinder
+const (
+	ParamTag = "param"
+	QueryTag = "query"
+	FormTag  = "form"
+)
+
+type (
+	// Binder is the interface that wraps the Bind method.
+	Binder interface {
+		Bind(i interface{}, c Context) error
+	}
+
+	// DefaultBinder is the default implementation of the Binder interface.
+	// It binds path params (`param` tag), query values (`query` tag) and then
+	// the request body according to its Content-Type, so the body wins on conflict.
+	DefaultBinder struct{}
+)
+
+// Bind implements the Binder#Bind function.
+func (b *DefaultBinder) Bind(i interface{}, c Context) error {
+	params := make(map[string][]string)
+	values := c.ParamValues()
+	for i, name := range c.ParamNames() {
+		params[name] = []string{values[i]}
+	}
+	if err := bindData(i, params, ParamTag); err != nil {
+		return NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := bindData(i, c.QueryParams(), QueryTag); err != nil {
+		return NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	req := c.Request()
+	if req.ContentLength == 0 {
+		return nil
+	}
+
+	ctype := req.Header.Get(HeaderContentType)
+	switch {
+	case strings.HasPrefix(ctype, MIMEApplicationJSON):
+		if err := c.EasyHandler().JSONSerializer.Deserialize(req.Body, i); err != nil {
+			if ute, ok := err.(*json.UnmarshalTypeError); ok {
+				return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unmarshal type error: expected=%v, got=%v, field=%v, offset=%v", ute.Type, ute.Value, ute.Field, ute.Offset))
+			} else if se, ok := err.(*json.SyntaxError); ok {
+				return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Syntax error: offset=%v, error=%v", se.Offset, se.Error()))
+			}
+			return NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	case strings.HasPrefix(ctype, MIMEApplicationXML), strings.HasPrefix(ctype, MIMETextXML):
+		if err := xml.NewDecoder(req.Body).Decode(i); err != nil {
+			if ute, ok := err.(*xml.UnsupportedTypeError); ok {
+				return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Unsupported type error: type=%v, error=%v", ute.Type, ute.Error()))
+			} else if se, ok := err.(*xml.SyntaxError); ok {
+				return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Syntax error: line=%v, error=%v", se.Line, se.Error()))
+			}
+			return NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	case strings.HasPrefix(ctype, MIMEApplicationForm), strings.HasPrefix(ctype, MIMEMultipartForm):
+		params, err := c.FormParams()
+		if err != nil {
+			return NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err = bindData(i, params, FormTag); err != nil {
+			return NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+	default:
+		return NewHTTPError(http.StatusUnsupportedMediaType)
+	}
+
+	return nil
+}
+
+// Bind data to the tagged fields of the struct which ptr points to.
+// Untagged struct fields are walked recursively, tag "-" is skipped.
+func bindData(ptr interface{}, data map[string][]string, tag string) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	typ := reflect.TypeOf(ptr)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		return errors.New("binding element must be a pointer")
+	}
+	typ = typ.Elem()
+	val := reflect.ValueOf(ptr).Elem()
+
+	if typ.Kind() != reflect.Struct {
+		// Maps and other targets are only filled from the body
+		return nil
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		typeField := typ.Field(i)
+		structField := val.Field(i)
+		if !structField.CanSet() {
+			continue
+		}
+
+		inputFieldName := typeField.Tag.Get(tag)
+		if inputFieldName == "-" {
+			continue
+		}
+		if inputFieldName == "" {
+			if structField.Kind() == reflect.Struct {
+				if err := bindData(structField.Addr().Interface(), data, tag); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		inputValue, exists := data[inputFieldName]
+		if !exists || len(inputValue) == 0 {
+			continue
+		}
+
+		if structField.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(structField.Type(), len(inputValue), len(inputValue))
+			for j, v := range inputValue {
+				if err := setWithProperType(v, slice.Index(j)); err != nil {
+					return fmt.Errorf("%s: %v", inputFieldName, err)
+				}
+			}
+			structField.Set(slice)
+			continue
+		}
+
+		if err := setWithProperType(inputValue[0], structField); err != nil {
+			return fmt.Errorf("%s: %v", inputFieldName, err)
+		}
+	}
+
+	return nil
+}
+
+// Parse value according to the kind of field and set it
+func setWithProperType(value string, field reflect.Value) error {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		return setWithProperType(value, field.Elem())
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		if value == "" {
+			value = "false"
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value == "" {
+			value = "0"
+		}
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value == "" {
+			value = "0"
+		}
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if value == "" {
+			value = "0"
+		}
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return errors.New("unknown type")
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serveBody(eh *EasyHandler, method, target, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set(HeaderContentType, contentType)
+	}
+	rec := httptest.NewRecorder()
+	eh.ServeHTTP(rec, req)
+	return rec
+}
+
+// Every field can be set by each source
+type bindUser struct {
+	ID   int      `param:"id" query:"id" form:"id" json:"id"`
+	Name string   `param:"name" query:"name" form:"name" json:"name"`
+	Age  int      `query:"age" form:"age" json:"age"`
+	Tags []string `query:"tag" form:"tag" json:"tags"`
+}
+
+func TestBindPrecedence(t *testing.T) {
+	eh := NewEasyHandler()
+	bound := func(c Context) error {
+		u := &bindUser{}
+		if err := c.Bind(u); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, u)
+	}
+	eh.POST("/users/:id", bound)
+	eh.POST("/users/:id/:name", bound)
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		want        bindUser
+	}{
+		{
+			name:   "path param",
+			target: "/users/1",
+			want:   bindUser{ID: 1},
+		},
+		{
+			name:   "query overrides path param",
+			target: "/users/1/param?id=2&tag=a&tag=b",
+			want:   bindUser{ID: 2, Name: "param", Tags: []string{"a", "b"}},
+		},
+		{
+			name:        "form overrides query and path param",
+			target:      "/users/1/param?id=2&name=query&age=20",
+			contentType: MIMEApplicationForm,
+			body:        "id=3&name=form&tag=c",
+			want:        bindUser{ID: 3, Name: "form", Age: 20, Tags: []string{"c"}},
+		},
+		{
+			name:        "json overrides query and path param",
+			target:      "/users/1/param?id=2&name=query&age=20",
+			contentType: MIMEApplicationJSON,
+			body:        `{"id":4,"tags":["d"]}`,
+			want:        bindUser{ID: 4, Name: "query", Age: 20, Tags: []string{"d"}},
+		},
+		{
+			name:        "empty body keeps query and path param",
+			target:      "/users/1/param?age=20",
+			contentType: MIMEApplicationJSON,
+			want:        bindUser{ID: 1, Name: "param", Age: 20},
+		},
+	}
+
+	for _, tt := range tests {
+		rec := serveBody(eh, POST, tt.target, tt.contentType, tt.body)
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: code = %d, body %s", tt.name, rec.Code, rec.Body)
+			continue
+		}
+		want, _ := json.Marshal(tt.want)
+		if got := strings.TrimSpace(rec.Body.String()); got != string(want) {
+			t.Errorf("%s: bound %s, want %s", tt.name, got, want)
+		}
+	}
+}
+
+func TestBindError(t *testing.T) {
+	eh := NewEasyHandler()
+	eh.POST("/users/:id", func(c Context) error {
+		if err := c.Bind(&bindUser{}); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"invalid path param", "/users/x", "", "", http.StatusBadRequest},
+		{"invalid query", "/users/1?age=old", "", "", http.StatusBadRequest},
+		{"invalid form", "/users/1", MIMEApplicationForm, "age=old", http.StatusBadRequest},
+		{"json syntax", "/users/1", MIMEApplicationJSON, `{"id":`, http.StatusBadRequest},
+		{"json type", "/users/1", MIMEApplicationJSON, `{"id":"x"}`, http.StatusBadRequest},
+		{"unsupported media type", "/users/1", "application/octet-stream", "x", http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		rec := serveBody(eh, POST, tt.target, tt.contentType, tt.body)
+		if rec.Code != tt.code {
+			t.Errorf("%s: code = %d, want %d, body %s", tt.name, rec.Code, tt.code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Byte order of the frame, tcp.byte_order in app.ini
+const (
+	BigEndian    = "big"
+	LittleEndian = "little"
+)
+
+// Size of MessageHeader in the frame
+const messageHeaderSize = 8
+
+// Max frame length of a codec which sets none, the default of tcp.max_frame_length
+const DefaultMaxFrameLength = 64 << 10
+
+// ErrFrameTooLarge is returned when a frame is longer than the limit of the codec.
+var ErrFrameTooLarge = errors.New("tcp: frame too large")
+
+type (
+	// Codec splits the TCP stream into messages and frames messages to be sent.
+	Codec interface {
+		// Decode reads one message from r.
+		Decode(r *bufio.Reader) (*Message, error)
+
+		// Encode returns the frame of msg.
+		Encode(msg *Message) ([]byte, error)
+	}
+
+	// MessageHeader is written in front of every message body.
+	MessageHeader struct {
+		// Command id, selects the handler registered by TCPServer.Handle
+		ID uint32
+		// Sequence number, a reply carries the one of its request
+		Seq uint32
+	}
+
+	// Message is a decoded frame.
+	Message struct {
+		MessageHeader
+		Body []byte
+	}
+
+	// LengthFieldCodec is a length-prefixed framing codec. A frame is
+	//   | length | command id uint32 | sequence uint32 | body |
+	// length is LengthSize bytes and counts everything after itself.
+	LengthFieldCodec struct {
+		// Size of the length field: 1, 2, 4 or 8 bytes
+		LengthSize int
+		ByteOrder  binary.ByteOrder
+		// Max value of the length field, larger frames are rejected before
+		// their body is read. 0 is DefaultMaxFrameLength.
+		MaxFrameLength uint64
+	}
+)
+
+// Returns a instance of *LengthFieldCodec
+// maxFrameLength 0 is DefaultMaxFrameLength, a limit over the length field is
+// lowered to the largest value it can hold.
+func NewLengthFieldCodec(lengthSize int, byteOrder string, maxFrameLength uint64) (*LengthFieldCodec, error) {
+	lc := &LengthFieldCodec{
+		LengthSize:     lengthSize,
+		MaxFrameLength: maxFrameLength,
+	}
+
+	switch strings.ToLower(byteOrder) {
+	case BigEndian:
+		lc.ByteOrder = binary.BigEndian
+	case LittleEndian:
+		lc.ByteOrder = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("tcp: unknown byte order %q", byteOrder)
+	}
+
+	switch lengthSize {
+	case 1, 2, 4, 8:
+	default:
+		return nil, fmt.Errorf("tcp: length size must be 1, 2, 4 or 8, got %d", lengthSize)
+	}
+
+	if maxFrameLength == 0 {
+		lc.MaxFrameLength = DefaultMaxFrameLength
+	}
+	if maxLen := lc.maxLength(); lc.MaxFrameLength > maxLen {
+		// The length field can not hold more
+		lc.MaxFrameLength = maxLen
+	}
+	if lc.MaxFrameLength < messageHeaderSize {
+		return nil, fmt.Errorf("tcp: max frame length must be at least %d", messageHeaderSize)
+	}
+
+	return lc, nil
+}
+
+func (lc *LengthFieldCodec) Decode(r *bufio.Reader) (*Message, error) {
+	var header [8 + messageHeaderSize]byte
+	lengthField := header[:lc.LengthSize]
+	if _, err := io.ReadFull(r, lengthField); err != nil {
+		return nil, err
+	}
+
+	// Checked before anything is allocated for the frame
+	length := lc.getLength(lengthField)
+	if length < messageHeaderSize {
+		return nil, fmt.Errorf("tcp: frame of %d bytes is shorter than the message header", length)
+	}
+	if limit := lc.maxFrameLength(); length > limit {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrFrameTooLarge, length, limit)
+	}
+
+	msgHeader := header[lc.LengthSize : lc.LengthSize+messageHeaderSize]
+	if _, err := io.ReadFull(r, msgHeader); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	msg := &Message{
+		MessageHeader: MessageHeader{
+			ID:  lc.ByteOrder.Uint32(msgHeader[:4]),
+			Seq: lc.ByteOrder.Uint32(msgHeader[4:]),
+		},
+		Body: make([]byte, length-messageHeaderSize),
+	}
+	if _, err := io.ReadFull(r, msg.Body); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return msg, nil
+}
+
+func (lc *LengthFieldCodec) Encode(msg *Message) ([]byte, error) {
+	length := uint64(messageHeaderSize + len(msg.Body))
+	if limit := lc.maxFrameLength(); length > limit {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrFrameTooLarge, length, limit)
+	}
+
+	b := make([]byte, uint64(lc.LengthSize)+length)
+	lc.putLength(b[:lc.LengthSize], length)
+	lc.ByteOrder.PutUint32(b[lc.LengthSize:], msg.ID)
+	lc.ByteOrder.PutUint32(b[lc.LengthSize+4:], msg.Seq)
+	copy(b[lc.LengthSize+messageHeaderSize:], msg.Body)
+
+	return b, nil
+}
+
+// MaxFrameLength, or the default when it is not set
+func (lc *LengthFieldCodec) maxFrameLength() uint64 {
+	if lc.MaxFrameLength == 0 {
+		return DefaultMaxFrameLength
+	}
+	return lc.MaxFrameLength
+}
+
+// Largest value the length field can hold
+func (lc *LengthFieldCodec) maxLength() uint64 {
+	if lc.LengthSize >= 8 {
+		return 1<<64 - 1
+	}
+	return 1<<(8*uint(lc.LengthSize)) - 1
+}
+
+func (lc *LengthFieldCodec) getLength(b []byte) uint64 {
+	switch lc.LengthSize {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(lc.ByteOrder.Uint16(b))
+	case 4:
+		return uint64(lc.ByteOrder.Uint32(b))
+	default:
+		return lc.ByteOrder.Uint64(b)
+	}
+}
+
+func (lc *LengthFieldCodec) putLength(b []byte, length uint64) {
+	switch lc.LengthSize {
+	case 1:
+		b[0] = byte(length)
+	case 2:
+		lc.ByteOrder.PutUint16(b, uint16(length))
+	case 4:
+		lc.ByteOrder.PutUint32(b, uint32(length))
+	default:
+		lc.ByteOrder.PutUint64(b, length)
+	}
+}
+
+// The stream ended in the middle of a frame
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func TestLengthFieldCodec(t *testing.T) {
+	tests := []struct {
+		lengthSize int
+		byteOrder  string
+		length     []byte
+	}{
+		{1, BigEndian, []byte{11}},
+		{2, BigEndian, []byte{0, 11}},
+		{2, LittleEndian, []byte{11, 0}},
+		{4, BigEndian, []byte{0, 0, 0, 11}},
+		{4, LittleEndian, []byte{11, 0, 0, 0}},
+		{8, BigEndian, []byte{0, 0, 0, 0, 0, 0, 0, 11}},
+		{8, LittleEndian, []byte{11, 0, 0, 0, 0, 0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		lc, err := NewLengthFieldCodec(tt.lengthSize, tt.byteOrder, 0)
+		if err != nil {
+			t.Fatalf("%d %s: %v", tt.lengthSize, tt.byteOrder, err)
+		}
+
+		msg := &Message{MessageHeader: MessageHeader{ID: 1, Seq: 2}, Body: []byte("abc")}
+		frame, err := lc.Encode(msg)
+		if err != nil {
+			t.Fatalf("%d %s: Encode: %v", tt.lengthSize, tt.byteOrder, err)
+		}
+		if got := frame[:tt.lengthSize]; !bytes.Equal(got, tt.length) {
+			t.Errorf("%d %s: length field = %v, want %v", tt.lengthSize, tt.byteOrder, got, tt.length)
+		}
+		if len(frame) != tt.lengthSize+11 {
+			t.Errorf("%d %s: frame of %d bytes, want %d", tt.lengthSize, tt.byteOrder, len(frame), tt.lengthSize+11)
+		}
+
+		got, err := lc.Decode(bufio.NewReader(bytes.NewReader(frame)))
+		if err != nil {
+			t.Fatalf("%d %s: Decode: %v", tt.lengthSize, tt.byteOrder, err)
+		}
+		if got.ID != 1 || got.Seq != 2 || string(got.Body) != "abc" {
+			t.Errorf("%d %s: Decode = %+v, want %+v", tt.lengthSize, tt.byteOrder, got, msg)
+		}
+	}
+}
+
+func TestNewLengthFieldCodec(t *testing.T) {
+	tests := []struct {
+		lengthSize     int
+		byteOrder      string
+		maxFrameLength uint64
+		want           uint64
+		wantErr        bool
+	}{
+		{1, BigEndian, 0, 255, false},
+		{1, BigEndian, 1 << 20, 255, false},
+		{2, BigEndian, 1024, 1024, false},
+		{2, LittleEndian, 1 << 20, 65535, false},
+		{4, BigEndian, 0, DefaultMaxFrameLength, false},
+		{8, BigEndian, 0, DefaultMaxFrameLength, false},
+		{8, LittleEndian, 1 << 30, 1 << 30, false},
+		{3, BigEndian, 0, 0, true},
+		{4, "middle", 0, 0, true},
+		{4, BigEndian, messageHeaderSize - 1, 0, true},
+	}
+
+	for _, tt := range tests {
+		lc, err := NewLengthFieldCodec(tt.lengthSize, tt.byteOrder, tt.maxFrameLength)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewLengthFieldCodec(%d, %q, %d) succeeded, want an error", tt.lengthSize, tt.byteOrder, tt.maxFrameLength)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewLengthFieldCodec(%d, %q, %d): %v", tt.lengthSize, tt.byteOrder, tt.maxFrameLength, err)
+			continue
+		}
+		if lc.MaxFrameLength != tt.want {
+			t.Errorf("NewLengthFieldCodec(%d, %q, %d).MaxFrameLength = %d, want %d", tt.lengthSize, tt.byteOrder, tt.maxFrameLength, lc.MaxFrameLength, tt.want)
+		}
+	}
+}
+
+func TestLengthFieldCodecDecodeError(t *testing.T) {
+	lc, err := NewLengthFieldCodec(8, BigEndian, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := func(length uint64, rest ...byte) []byte {
+		b := binary.BigEndian.AppendUint64(nil, length)
+		return append(b, rest...)
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  error
+	}{
+		// Only the length field is sent, the body must not be waited for nor allocated
+		{"too large", frame(1 << 62), ErrFrameTooLarge},
+		{"one over the limit", frame(1025), ErrFrameTooLarge},
+		{"shorter than the header", frame(messageHeaderSize - 1), nil},
+		{"truncated length", []byte{0, 0, 0}, io.ErrUnexpectedEOF},
+		{"truncated header", frame(messageHeaderSize, 0, 0, 0), io.ErrUnexpectedEOF},
+		{"truncated body", frame(messageHeaderSize+4, 0, 0, 0, 1, 0, 0, 0, 2, 'a'), io.ErrUnexpectedEOF},
+		{"empty", nil, io.EOF},
+	}
+
+	for _, tt := range tests {
+		_, err := lc.Decode(bufio.NewReader(bytes.NewReader(tt.frame)))
+		if err == nil {
+			t.Errorf("%s: Decode succeeded, want an error", tt.name)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: Decode error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestLengthFieldCodecEncodeTooLarge(t *testing.T) {
+	lc, err := NewLengthFieldCodec(1, BigEndian, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lc.Encode(&Message{Body: make([]byte, 255-messageHeaderSize)}); err != nil {
+		t.Errorf("Encode at the limit: %v", err)
+	}
+	if _, err := lc.Encode(&Message{Body: make([]byte, 256-messageHeaderSize)}); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("Encode over the limit error = %v, want ErrFrameTooLarge", err)
+	}
+}
+
+func TestLengthFieldCodecDecodeHugeLength(t *testing.T) {
+	tests := []struct {
+		lengthSize int
+		byteOrder  string
+		length     []byte
+	}{
+		{4, BigEndian, []byte{0xff, 0xff, 0xff, 0xff}},
+		{4, LittleEndian, []byte{0xff, 0xff, 0xff, 0xff}},
+		{8, BigEndian, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{8, LittleEndian, []byte{0, 0, 0, 0, 0, 0, 0, 0x40}},
+	}
+
+	for _, tt := range tests {
+		lc, err := NewLengthFieldCodec(tt.lengthSize, tt.byteOrder, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err = lc.Decode(bufio.NewReader(bytes.NewReader(tt.length)))
+		runtime.ReadMemStats(&after)
+
+		if !errors.Is(err, ErrFrameTooLarge) {
+			t.Errorf("%d %s: Decode error = %v, want ErrFrameTooLarge", tt.lengthSize, tt.byteOrder, err)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("%d %s: Decode allocated %d bytes for a rejected frame", tt.lengthSize, tt.byteOrder, allocated)
+		}
+	}
+
+	// A codec built without NewLengthFieldCodec has the default limit too
+	lc := &LengthFieldCodec{LengthSize: 8, ByteOrder: binary.BigEndian}
+	frame := binary.BigEndian.AppendUint64(nil, DefaultMaxFrameLength+1)
+	if _, err := lc.Decode(bufio.NewReader(bytes.NewReader(frame))); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("Decode error = %v, want ErrFrameTooLarge", err)
+	}
+}
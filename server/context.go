@@ -1,9 +1,18 @@
 package server
 
 import (
-	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/xxlixin1993/LiLGo/utils"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // MIME types
@@ -54,6 +63,12 @@ const (
 	TRACE   = "TRACE"
 )
 
+// ErrInvalidRedirectCode is returned by Redirect when the code is not a 3xx status
+var ErrInvalidRedirectCode = errors.New("invalid redirect status code")
+
+// Maximum bytes of a multipart body kept in memory, the rest is stored on disk
+const defaultMemory = 32 << 20 // 32 MB
+
 // Headers
 const (
 	HeaderAccept              = "Accept"
@@ -64,6 +79,7 @@ const (
 	HeaderContentEncoding     = "Content-Encoding"
 	HeaderContentLength       = "Content-Length"
 	HeaderContentType         = "Content-Type"
+	HeaderConnection          = "Connection"
 	HeaderCookie              = "Cookie"
 	HeaderSetCookie           = "Set-Cookie"
 	HeaderIfModifiedSince     = "If-Modified-Since"
@@ -115,12 +131,100 @@ type Context interface {
 	// Response returns `*Response`.
 	Response() *Response
 
+	// Path returns the registered path for the handler.
+	Path() string
+
+	// Param returns path parameter by name.
+	Param(name string) string
+
+	// ParamNames returns path parameter names.
+	ParamNames() []string
+
+	// SetParamNames sets path parameter names.
+	SetParamNames(names ...string)
+
+	// ParamValues returns path parameter values.
+	ParamValues() []string
+
+	// SetParamValues sets path parameter values.
+	SetParamValues(values ...string)
+
+	// QueryParam returns the query param for the provided name.
+	QueryParam(name string) string
+
+	// QueryParams returns the query parameters as `url.Values`.
+	QueryParams() url.Values
+
+	// QueryString returns the URL query string.
+	QueryString() string
+
+	// FormValue returns the form field value for the provided name.
+	FormValue(name string) string
+
+	// FormParams returns the form parameters as `url.Values`.
+	FormParams() (url.Values, error)
+
+	// FormFile returns the multipart form file for the provided name.
+	FormFile(name string) (*multipart.FileHeader, error)
+
+	// MultipartForm returns the multipart form.
+	MultipartForm() (*multipart.Form, error)
+
+	// Bind binds the request body into provided type `i`. The default binder
+	// does it based on Content-Type header.
+	Bind(i interface{}) error
+
+	// Validate validates provided `i`. It is usually called after `Context#Bind()`.
+	// Validation failures are returned as a 422 `*HTTPError`.
+	Validate(i interface{}) error
+
 	// NoContent sends a response with no body and a status code.
 	NoContent(code int) error
 
+	// String sends a string response with status code.
+	String(code int, s string) error
+
+	// HTML sends an HTTP response with status code.
+	HTML(code int, html string) error
+
 	// JSON sends a JSON response with status code.
 	JSON(code int, i interface{}) error
 
+	// JSONPretty sends a pretty-print JSON with status code.
+	JSONPretty(code int, i interface{}, indent string) error
+
+	// JSONP sends a JSONP response with status code. It uses `callback` to construct
+	// the JSONP payload.
+	JSONP(code int, callback string, i interface{}) error
+
+	// XML sends an XML response with status code.
+	XML(code int, i interface{}) error
+
+	// Blob sends a blob response with status code and content type.
+	Blob(code int, contentType string, b []byte) error
+
+	// Stream sends a streaming response with status code and content type.
+	Stream(code int, contentType string, r io.Reader) error
+
+	// File sends a response with the content of the file.
+	File(file string) error
+
+	// Attachment sends a response as attachment, prompting client to save the
+	// file.
+	Attachment(file string, name string) error
+
+	// Inline sends a response as inline, opening the file in the browser.
+	Inline(file string, name string) error
+
+	// Redirect redirects the request to a provided URL with status code.
+	Redirect(code int, url string) error
+
+	// SSE starts a server-sent events stream on the response.
+	SSE() (*SSEWriter, error)
+
+	// EasyHandler returns the `EasyHandler` instance.
+	EasyHandler() *EasyHandler
+
 	// Handler returns the matched handler by router.
 	Handler() HandlerFunc
 
@@ -139,6 +243,9 @@ type httpContext struct {
 	paramValues []string
 	query       url.Values
 	handler     HandlerFunc
+	easyHandler *EasyHandler
+	// Stream started by SSE, closed once the request is served
+	sse *SSEWriter
 }
 
 func (hc *httpContext) Request() *http.Request {
@@ -153,24 +260,216 @@ func (hc *httpContext) Response() *Response {
 	return hc.response
 }
 
+func (hc *httpContext) Path() string {
+	return hc.path
+}
+
+func (hc *httpContext) Param(name string) string {
+	for i, n := range hc.paramNames {
+		if n == name && i < len(hc.paramValues) {
+			return hc.paramValues[i]
+		}
+	}
+	return ""
+}
+
+func (hc *httpContext) ParamNames() []string {
+	return hc.paramNames
+}
+
+func (hc *httpContext) SetParamNames(names ...string) {
+	hc.paramNames = names
+}
+
+func (hc *httpContext) ParamValues() []string {
+	return hc.paramValues[:utils.MinInt(len(hc.paramNames), len(hc.paramValues))]
+}
+
+func (hc *httpContext) SetParamValues(values ...string) {
+	// Keep paramValues at least as long as the router needs
+	if len(values) > len(hc.paramValues) {
+		hc.paramValues = make([]string, len(values))
+	}
+	copy(hc.paramValues, values)
+}
+
+func (hc *httpContext) QueryParam(name string) string {
+	return hc.QueryParams().Get(name)
+}
+
+func (hc *httpContext) QueryParams() url.Values {
+	// Parse the query only once per request
+	if hc.query == nil {
+		hc.query = hc.request.URL.Query()
+	}
+	return hc.query
+}
+
+func (hc *httpContext) QueryString() string {
+	return hc.request.URL.RawQuery
+}
+
+func (hc *httpContext) FormValue(name string) string {
+	return hc.request.FormValue(name)
+}
+
+func (hc *httpContext) FormParams() (url.Values, error) {
+	if strings.HasPrefix(hc.request.Header.Get(HeaderContentType), MIMEMultipartForm) {
+		if err := hc.request.ParseMultipartForm(defaultMemory); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := hc.request.ParseForm(); err != nil {
+			return nil, err
+		}
+	}
+	return hc.request.Form, nil
+}
+
+func (hc *httpContext) FormFile(name string) (*multipart.FileHeader, error) {
+	_, fh, err := hc.request.FormFile(name)
+	return fh, err
+}
+
+func (hc *httpContext) MultipartForm() (*multipart.Form, error) {
+	err := hc.request.ParseMultipartForm(defaultMemory)
+	return hc.request.MultipartForm, err
+}
+
+func (hc *httpContext) Bind(i interface{}) error {
+	return hc.easyHandler.Binder.Bind(i, hc)
+}
+
+func (hc *httpContext) Validate(i interface{}) error {
+	if hc.easyHandler.Validator == nil {
+		return errors.New("validator not registered")
+	}
+	return newValidationError(hc.easyHandler.Validator.Validate(i))
+}
+
 func (hc *httpContext) NoContent(code int) error {
 	hc.response.WriteHeader(code)
 	return nil
 }
 
+func (hc *httpContext) String(code int, s string) error {
+	return hc.Blob(code, MIMETextPlainCharsetUTF8, []byte(s))
+}
+
+func (hc *httpContext) HTML(code int, html string) error {
+	return hc.Blob(code, MIMETextHTMLCharsetUTF8, []byte(html))
+}
+
 func (hc *httpContext) JSON(code int, i interface{}) error {
-	b, err := json.Marshal(i)
+	return hc.json(code, i, "")
+}
+
+func (hc *httpContext) JSONPretty(code int, i interface{}, indent string) error {
+	return hc.json(code, i, indent)
+}
+
+func (hc *httpContext) JSONP(code int, callback string, i interface{}) error {
+	b, err := hc.easyHandler.JSONSerializer.Serialize(i, "")
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 0, len(callback)+len(b)+3)
+	buf = append(buf, callback...)
+	buf = append(buf, '(')
+	buf = append(buf, b...)
+	buf = append(buf, ");"...)
+	return hc.Blob(code, MIMEApplicationJavaScriptCharsetUTF8, buf)
+}
+
+func (hc *httpContext) XML(code int, i interface{}) error {
+	b, err := xml.Marshal(i)
 	if err != nil {
 		return err
 	}
 
-	hc.writeContentType(MIMEApplicationJavaScriptCharsetUTF8)
+	buf := make([]byte, 0, len(xml.Header)+len(b))
+	buf = append(buf, xml.Header...)
+	buf = append(buf, b...)
+	return hc.Blob(code, MIMEApplicationXMLCharsetUTF8, buf)
+}
+
+// A HEAD request gets the headers of the body but not the body itself
+func (hc *httpContext) Blob(code int, contentType string, b []byte) error {
+	hc.writeContentType(contentType)
+	if hc.request.Method == HEAD {
+		hc.response.Header().Set(HeaderContentLength, strconv.Itoa(len(b)))
+		hc.response.WriteHeader(code)
+		return nil
+	}
+
 	hc.response.WriteHeader(code)
-	_, err = hc.response.Write(b)
+	_, err := hc.response.Write(b)
+	return err
+}
 
+func (hc *httpContext) Stream(code int, contentType string, r io.Reader) error {
+	hc.writeContentType(contentType)
+	hc.response.WriteHeader(code)
+	if hc.request.Method == HEAD {
+		return nil
+	}
+
+	_, err := io.Copy(hc.response, r)
 	return err
 }
 
+// Serves index.html for a directory. Ranges, conditional requests and HEAD
+// are handled by http.ServeContent.
+func (hc *httpContext) File(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return NotFoundHandler(hc)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		file = filepath.Join(file, "index.html")
+		f, err = os.Open(file)
+		if err != nil {
+			return NotFoundHandler(hc)
+		}
+		defer f.Close()
+		if fi, err = f.Stat(); err != nil {
+			return err
+		}
+	}
+
+	http.ServeContent(hc.response, hc.request, fi.Name(), fi.ModTime(), f)
+	return nil
+}
+
+func (hc *httpContext) Attachment(file, name string) error {
+	return hc.contentDisposition(file, name, "attachment")
+}
+
+func (hc *httpContext) Inline(file, name string) error {
+	return hc.contentDisposition(file, name, "inline")
+}
+
+func (hc *httpContext) Redirect(code int, url string) error {
+	if code < http.StatusMultipleChoices || code > http.StatusPermanentRedirect {
+		return ErrInvalidRedirectCode
+	}
+
+	hc.response.Header().Set(HeaderLocation, url)
+	hc.response.WriteHeader(code)
+	return nil
+}
+
+func (hc *httpContext) EasyHandler() *EasyHandler {
+	return hc.easyHandler
+}
+
 func (hc *httpContext) Handler() HandlerFunc {
 	return hc.handler
 }
@@ -182,10 +481,28 @@ func (hc *httpContext) SetHandler(h HandlerFunc) {
 func (hc *httpContext) Reset(r *http.Request, w http.ResponseWriter) {
 	hc.request = r
 	hc.response.reset(w)
+	hc.handler = NotFoundHandler
 	hc.path = ""
 	hc.paramNames = nil
-	hc.paramValues = nil
+	if maxParam := hc.easyHandler.router.maxParam; len(hc.paramValues) < maxParam {
+		// A route with more params was registered after this context was pooled
+		hc.paramValues = make([]string, maxParam)
+	}
 	hc.query = nil
+	hc.sse = nil
+}
+
+func (hc *httpContext) json(code int, i interface{}, indent string) error {
+	b, err := hc.easyHandler.JSONSerializer.Serialize(i, indent)
+	if err != nil {
+		return err
+	}
+	return hc.Blob(code, MIMEApplicationJSONCharsetUTF8, b)
+}
+
+func (hc *httpContext) contentDisposition(file, name, dispositionType string) error {
+	hc.response.Header().Set(HeaderContentDisposition, fmt.Sprintf("%s; filename=%q", dispositionType, name))
+	return hc.File(file)
 }
 
 func (hc *httpContext) writeContentType(value string) {
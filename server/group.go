@@ -0,0 +1,109 @@
+package server
+
+// Group is a set of sub-routes under a common prefix that share middleware.
+type Group struct {
+	prefix     string
+	middleware []MiddlewareFunc
+	eh         *EasyHandler
+}
+
+// Group creates a new router group with prefix and optional group-level middleware.
+func (eh *EasyHandler) Group(prefix string, middleware ...MiddlewareFunc) *Group {
+	g := &Group{prefix: prefix, eh: eh}
+	g.Use(middleware...)
+	return g
+}
+
+// Use adds middleware to the group. It only applies to routes registered
+// on the group after this call.
+func (g *Group) Use(middleware ...MiddlewareFunc) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// CONNECT registers a new CONNECT route for a path with matching handler in the group
+// with optional route-level middleware.
+func (g *Group) CONNECT(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	g.Add(CONNECT, path, h, m...)
+}
+
+// DELETE registers a new DELETE route for a path with matching handler in the group
+// with optional route-level middleware.
+func (g *Group) DELETE(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	g.Add(DELETE, path, h, m...)
+}
+
+// GET registers a new GET route for a path with matching handler in the group
+// with optional route-level middleware.
+func (g *Group) GET(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	g.Add(GET, path, h, m...)
+}
+
+// HEAD registers a new HEAD route for a path with matching handler in the group
+// with optional route-level middleware.
+func (g *Group) HEAD(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	g.Add(HEAD, path, h, m...)
+}
+
+// OPTIONS registers a new OPTIONS route for a path with matching handler in the group
+// with optional route-level middleware.
+func (g *Group) OPTIONS(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	g.Add(OPTIONS, path, h, m...)
+}
+
+// PATCH registers a new PATCH route for a path with matching handler in the group
+// with optional route-level middleware.
+func (g *Group) PATCH(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	g.Add(PATCH, path, h, m...)
+}
+
+// POST registers a new POST route for a path with matching handler in the group
+// with optional route-level middleware.
+func (g *Group) POST(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	g.Add(POST, path, h, m...)
+}
+
+// PUT registers a new PUT route for a path with matching handler in the group
+// with optional route-level middleware.
+func (g *Group) PUT(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	g.Add(PUT, path, h, m...)
+}
+
+// TRACE registers a new TRACE route for a path with matching handler in the group
+// with optional route-level middleware.
+func (g *Group) TRACE(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	g.Add(TRACE, path, h, m...)
+}
+
+// Any registers a new route for all supported HTTP methods and path with matching handler
+// in the group with optional route-level middleware.
+func (g *Group) Any(path string, h HandlerFunc, middleware ...MiddlewareFunc) {
+	for _, m := range allowMethods {
+		g.Add(m, path, h, middleware...)
+	}
+}
+
+// Match registers a new route for multiple HTTP methods and path with matching handler
+// in the group with optional route-level middleware.
+func (g *Group) Match(methods []string, path string, h HandlerFunc, middleware ...MiddlewareFunc) {
+	for _, m := range methods {
+		g.Add(m, path, h, middleware...)
+	}
+}
+
+// Group creates a nested group. The sub-group inherits the prefix and the
+// middleware of its parent.
+func (g *Group) Group(prefix string, middleware ...MiddlewareFunc) *Group {
+	m := make([]MiddlewareFunc, 0, len(g.middleware)+len(middleware))
+	m = append(m, g.middleware...)
+	m = append(m, middleware...)
+	return g.eh.Group(g.prefix+prefix, m...)
+}
+
+// Add registers a new route for an HTTP method and path with matching handler
+// in the group. Group middleware runs before the route-level middleware.
+func (g *Group) Add(method, path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	m := make([]MiddlewareFunc, 0, len(g.middleware)+len(middleware))
+	m = append(m, g.middleware...)
+	m = append(m, middleware...)
+	g.eh.Add(method, g.prefix+path, handler, m...)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGroupMiddleware(t *testing.T) {
+	tr := &trace{}
+	eh := NewEasyHandler()
+	eh.Use(tr.middleware("use"))
+
+	api := eh.Group("/api", tr.middleware("api"))
+	api.GET("/before", tr.handler("before"))
+	// Only applies to the routes added after it
+	api.Use(tr.middleware("api2"))
+	api.GET("/after", tr.handler("after"), tr.middleware("route"))
+
+	v1 := api.Group("/v1", tr.middleware("v1"))
+	v1.GET("/users", tr.handler("users"))
+	// Does not leak into the parent group
+	api.GET("/status", tr.handler("status"))
+
+	eh.GET("/plain", tr.handler("plain"))
+
+	tests := []struct {
+		method string
+		target string
+		code   int
+		layers string
+	}{
+		{GET, "/api/before", http.StatusNoContent, "use(/api/before),api(/api/before),before"},
+		{GET, "/api/after", http.StatusNoContent, "use(/api/after),api(/api/after),api2(/api/after),route(/api/after),after"},
+		{GET, "/api/v1/users", http.StatusNoContent, "use(/api/v1/users),api(/api/v1/users),api2(/api/v1/users),v1(/api/v1/users),users"},
+		{GET, "/api/status", http.StatusNoContent, "use(/api/status),api(/api/status),api2(/api/status),status"},
+		{GET, "/plain", http.StatusNoContent, "use(/plain),plain"},
+		// Routes missing from the group only run through Use
+		{GET, "/api/missing", http.StatusNotFound, "use(/api/missing)"},
+	}
+
+	for _, tt := range tests {
+		tr.layers = nil
+		rec := serve(eh, tt.method, tt.target)
+		if rec.Code != tt.code {
+			t.Errorf("%s %s: code = %d, want %d", tt.method, tt.target, rec.Code, tt.code)
+		}
+		if got := strings.Join(tr.layers, ","); got != tt.layers {
+			t.Errorf("%s %s: layers = %s, want %s", tt.method, tt.target, got, tt.layers)
+		}
+	}
+}
+
+func TestGroupMiddlewareShortCircuit(t *testing.T) {
+	eh := NewEasyHandler()
+	admin := eh.Group("/admin", func(next HandlerFunc) HandlerFunc {
+		return func(c Context) error {
+			if c.Request().Header.Get(HeaderAuthorization) == "" {
+				return NewHTTPError(http.StatusUnauthorized)
+			}
+			return next(c)
+		}
+	})
+	admin.GET("/users", echoParams)
+	eh.GET("/users", echoParams)
+
+	if rec := serve(eh, GET, "/admin/users"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /admin/users: code = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := serve(eh, GET, "/users"); rec.Code != http.StatusOK {
+		t.Errorf("GET /users: code = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
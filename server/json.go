@@ -0,0 +1,34 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type (
+	// JSONSerializer is the interface that encodes and decodes JSON to and from
+	// interfaces. It is used by the JSON renderers and by DefaultBinder.
+	JSONSerializer interface {
+		// Serialize encodes i, indent is used for pretty-print when not empty.
+		Serialize(i interface{}, indent string) ([]byte, error)
+
+		// Deserialize decodes the JSON read from r into i.
+		Deserialize(r io.Reader, i interface{}) error
+	}
+
+	// DefaultJSONSerializer implements JSONSerializer with encoding/json.
+	DefaultJSONSerializer struct{}
+)
+
+// Serialize implements the JSONSerializer#Serialize function.
+func (d DefaultJSONSerializer) Serialize(i interface{}, indent string) ([]byte, error) {
+	if indent != "" {
+		return json.MarshalIndent(i, "", indent)
+	}
+	return json.Marshal(i)
+}
+
+// Deserialize implements the JSONSerializer#Deserialize function.
+func (d DefaultJSONSerializer) Deserialize(r io.Reader, i interface{}) error {
+	return json.NewDecoder(r).Decode(i)
+}
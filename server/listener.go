@@ -0,0 +1,231 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xxlixin1993/LiLGo/configure"
+	"github.com/xxlixin1993/LiLGo/graceful"
+	"github.com/xxlixin1993/LiLGo/logging"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Listener type, http.listen in app.ini
+const (
+	ListenTCP     = "tcp"
+	ListenUnix    = "unix"
+	ListenSystemd = "systemd"
+)
+
+// First file descriptor passed by socket activation, SD_LISTEN_FDS_START
+const listenFdsStart = 3
+
+// Listener names passed on graceful restart
+const (
+	HTTPListenerName          = "http"
+	HTTPSRedirectListenerName = "https_redirect"
+	TCPListenerName           = "tcp"
+)
+
+// Take the listener passed by the old process on graceful restart, or open a
+// new one. The listener is registered to be passed on the next restart.
+func inheritOrListen(name string, open func() (net.Listener, error)) (net.Listener, error) {
+	l, err := graceful.InheritedListener(name)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		if l, err = open(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := graceful.RegisterListener(name, l); err != nil {
+		logging.Warning(err)
+	}
+	return l, nil
+}
+
+// Open the listener selected by http.listen
+func (h *HTTPServer) listen() (net.Listener, error) {
+	return inheritOrListen(HTTPListenerName, h.openListener)
+}
+
+func (h *HTTPServer) openListener() (net.Listener, error) {
+	switch listenType := configure.DefaultString("http.listen", ListenTCP); listenType {
+	case ListenTCP:
+		return net.Listen("tcp", h.socketLink)
+	case ListenUnix:
+		path := configure.DefaultString("http.unix_socket", "")
+		if path == "" {
+			return nil, errors.New("listen: http.unix_socket is required")
+		}
+		h.socketLink = path
+		return listenUnix(path,
+			configure.DefaultString("http.unix_socket_mode", ""),
+			configure.DefaultString("http.unix_socket_owner", ""))
+	case ListenSystemd:
+		listeners, err := activationListeners()
+		if err != nil {
+			return nil, err
+		}
+		return selectListener(listeners, configure.DefaultString("http.systemd_name", ""))
+	default:
+		return nil, fmt.Errorf("listen: unknown http.listen %q", listenType)
+	}
+}
+
+// Listen on a unix socket. mode is octal like 0660, owner is user[:group].
+func listenUnix(path, mode, owner string) (net.Listener, error) {
+	// Remove the socket left by a process which did not exit cleanly
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("listen: %s exists and is not a socket", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("listen: invalid http.unix_socket_mode %q", mode)
+		}
+		if err = os.Chmod(path, os.FileMode(m)); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	if owner != "" {
+		uid, gid, err := lookupOwner(owner)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		if err = os.Chown(path, uid, gid); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// Returns uid and gid of user[:group], -1 leaves it unchanged
+func lookupOwner(owner string) (uid int, gid int, err error) {
+	uid, gid = -1, -1
+	userName, groupName := owner, ""
+	if n := strings.IndexByte(owner, ':'); n >= 0 {
+		userName, groupName = owner[:n], owner[n+1:]
+	}
+
+	if userName != "" {
+		u, err := user.Lookup(userName)
+		if err != nil {
+			return 0, 0, err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return 0, 0, err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// Listeners passed by systemd socket activation (LISTEN_PID, LISTEN_FDS, LISTEN_FDNAMES).
+// The variables are unset so that child processes do not take them.
+func activationListeners() (map[string]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("listen: no socket passed by socket activation")
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, errors.New("listen: no socket passed by socket activation")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	return fileListeners(n, names)
+}
+
+// Wrap the inherited descriptors 3 ~ 3+n-1 as listeners, keyed by name or by fd
+func fileListeners(n int, names []string) (map[string]net.Listener, error) {
+	listeners := make(map[string]net.Listener, n)
+	for i := 0; i < n; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+
+		name := strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		// FileListener dups the descriptor
+		f.Close()
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("listen: fd %d: %v", fd, err)
+		}
+		listeners[name] = l
+	}
+
+	return listeners, nil
+}
+
+// Take the listener called name, or the only one when name is empty
+func selectListener(listeners map[string]net.Listener, name string) (net.Listener, error) {
+	if name != "" {
+		l, ok := listeners[name]
+		if !ok {
+			return nil, fmt.Errorf("listen: no socket named %q", name)
+		}
+		for n, other := range listeners {
+			if n != name {
+				other.Close()
+			}
+		}
+		return l, nil
+	}
+
+	if len(listeners) != 1 {
+		for _, l := range listeners {
+			l.Close()
+		}
+		return nil, fmt.Errorf("listen: %d sockets passed, set http.systemd_name", len(listeners))
+	}
+	for _, l := range listeners {
+		return l, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"github.com/xxlixin1993/LiLGo/configure"
+	"github.com/xxlixin1993/LiLGo/graceful"
+	"github.com/xxlixin1993/LiLGo/logging"
+	"os"
+	"testing"
+)
+
+// The handlers read app.debug and log through the log module
+func TestMain(m *testing.M) {
+	f, err := os.CreateTemp("", "lilgo-*.ini")
+	if err != nil {
+		panic(err)
+	}
+	f.WriteString("[local]\napp.debug = true\nlog.output = stdout\n")
+	f.Close()
+	defer os.Remove(f.Name())
+
+	graceful.InitExitList()
+	if err := configure.InitConfig(f.Name(), "local"); err != nil {
+		panic(err)
+	}
+	if err := logging.InitLog(); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.Remove(f.Name())
+	os.Exit(code)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"github.com/xxlixin1993/LiLGo/configure"
+	"github.com/xxlixin1993/LiLGo/graceful"
+	"github.com/xxlixin1993/LiLGo/logging"
+	"net/http"
+)
+
+type (
+	// HTTPModule runs an EasyHandler as a lifecycle module. It serves https
+	// when http.tls_cert is set, http otherwise.
+	HTTPModule struct {
+		eh     *EasyHandler
+		server *HTTPServer
+	}
+
+	// TCPModule runs a TCPServer as a lifecycle module.
+	TCPModule struct {
+		ts *TCPServer
+	}
+)
+
+// Returns a instance of *HTTPModule
+func NewHTTPModule(eh *EasyHandler) *HTTPModule {
+	return &HTTPModule{eh: eh}
+}
+
+// Implement lifecycle.Module
+func (m *HTTPModule) GetModuleName() string {
+	return KHttpServerModuleName
+}
+
+// Implement lifecycle.Module
+// It returns once the listener is open, the requests are served in background.
+func (m *HTTPModule) Start(ctx context.Context) error {
+	var serve func(*http.Server) error
+	if configure.DefaultString("http.tls_cert", "") != "" {
+		listener, err := m.eh.listenTLS()
+		if err != nil {
+			return err
+		}
+		serve = func(s *http.Server) error { return s.ServeTLS(listener, "", "") }
+	} else {
+		listener, err := m.eh.listenHTTP()
+		if err != nil {
+			return err
+		}
+		serve = func(s *http.Server) error { return s.Serve(listener) }
+	}
+	m.server = httpServer
+
+	go func() {
+		if err := serve(m.server.server); err != nil && err != http.ErrServerClosed {
+			logging.ErrorF("http: serve %s error: %v", m.server.socketLink, err)
+		}
+	}()
+
+	return nil
+}
+
+// Implement lifecycle.Module
+func (m *HTTPModule) Stop(ctx context.Context) error {
+	return m.server.StopContext(ctx)
+}
+
+// Implement StageInterface
+func (m *HTTPModule) GetStopStage() int {
+	return graceful.StageServer
+}
+
+// Returns a instance of *TCPModule
+func NewTCPModule(ts *TCPServer) *TCPModule {
+	return &TCPModule{ts: ts}
+}
+
+// Implement lifecycle.Module
+func (m *TCPModule) GetModuleName() string {
+	return KTcpServerModuleName
+}
+
+// Implement lifecycle.Module
+// It returns once the listener is open, the connections are served in background.
+func (m *TCPModule) Start(ctx context.Context) error {
+	if err := m.ts.listen(); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := m.ts.serve(); err != nil {
+			logging.ErrorF("tcp: serve %s error: %v", m.ts.socketLink, err)
+		}
+	}()
+
+	return nil
+}
+
+// Implement lifecycle.Module
+func (m *TCPModule) Stop(ctx context.Context) error {
+	return m.ts.StopContext(ctx)
+}
+
+// Implement StageInterface
+func (m *TCPModule) GetStopStage() int {
+	return graceful.StageServer
+}
@@ -2,11 +2,14 @@ package server
 
 import (
 	"github.com/xxlixin1993/LiLGo/utils"
+	"strings"
 )
 
 type (
 	Router struct {
 		tree *node
+		// 所有路由中参数个数的最大值 用于预分配httpContext.paramValues
+		maxParam int
 	}
 
 	node struct {
@@ -77,7 +80,12 @@ func (r *Router) Add(method, path string, h HandlerFunc) {
 		path = "/" + path
 	}
 
+	if n := strings.Count(path, ":") + strings.Count(path, "*"); n > r.maxParam {
+		r.maxParam = n
+	}
+
 	var matchParam []string
+	realPath := path
 
 	for i, length := 0, len(path); i < length; i++ {
 		if path[i] == ':' {
@@ -93,22 +101,22 @@ func (r *Router) Add(method, path string, h HandlerFunc) {
 			i, length = j, len(path)
 
 			if i == length {
-				r.insert(method, path[:i], h, paramNodeType, path, matchParam)
+				r.insert(method, path[:i], h, paramNodeType, realPath, matchParam)
 				return
 			}
 
-			r.insert(method, path[:i], nil, paramNodeType, path, matchParam)
+			r.insert(method, path[:i], nil, paramNodeType, realPath, matchParam)
 		} else if path[i] == '*' {
 			// match *
 			r.insert(method, path[:i], nil, staticNodeType, "", nil)
 
 			matchParam = append(matchParam, "*")
-			r.insert(method, path[:i+1], h, anyNodeType, path, matchParam)
+			r.insert(method, path[:i+1], h, anyNodeType, realPath, matchParam)
 			return
 		}
 	}
 
-	r.insert(method, path, h, staticNodeType, path, matchParam)
+	r.insert(method, path, h, staticNodeType, realPath, matchParam)
 }
 
 func (r *Router) insert(method, insertPath string, h HandlerFunc, nodeT nodeType, realPath string, matchParam []string) {
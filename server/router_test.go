@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Responds with the route path and the params of the request
+func echoParams(c Context) error {
+	values := c.ParamValues()
+	pairs := make([]string, 0, len(c.ParamNames()))
+	for i, name := range c.ParamNames() {
+		pairs = append(pairs, name+"="+values[i])
+	}
+	return c.String(http.StatusOK, c.Path()+" "+strings.Join(pairs, ","))
+}
+
+func serve(eh *EasyHandler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	eh.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestRouterFind(t *testing.T) {
+	eh := NewEasyHandler()
+	eh.GET("/users", echoParams)
+	eh.GET("/users/:id", echoParams)
+	eh.GET("/users/:uid/posts/:pid", echoParams)
+	eh.GET("/static/*", echoParams)
+
+	tests := []struct {
+		target string
+		code   int
+		body   string
+	}{
+		{"/users", http.StatusOK, "/users "},
+		{"/users/42", http.StatusOK, "/users/:id id=42"},
+		{"/users/7/posts/9", http.StatusOK, "/users/:uid/posts/:pid uid=7,pid=9"},
+		{"/static/css/app.css", http.StatusOK, "/static/* *=css/app.css"},
+		{"/static/", http.StatusOK, "/static/* *="},
+		{"/users/7/posts", http.StatusNotFound, ""},
+		{"/nothing", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		rec := serve(eh, GET, tt.target)
+		if rec.Code != tt.code {
+			t.Errorf("GET %s: code %d, want %d", tt.target, rec.Code, tt.code)
+			continue
+		}
+		if tt.code == http.StatusOK && rec.Body.String() != tt.body {
+			t.Errorf("GET %s: body %q, want %q", tt.target, rec.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestRouterMoreParamsAfterPooled(t *testing.T) {
+	eh := NewEasyHandler()
+	eh.GET("/a/:x", echoParams)
+
+	// Pool a context sized for one param
+	if rec := serve(eh, GET, "/a/1"); rec.Body.String() != "/a/:x x=1" {
+		t.Fatalf("body %q", rec.Body.String())
+	}
+
+	eh.GET("/b/:p1/:p2/:p3", echoParams)
+	rec := serve(eh, GET, "/b/1/2/3")
+	if rec.Code != http.StatusOK || rec.Body.String() != "/b/:p1/:p2/:p3 p1=1,p2=2,p3=3" {
+		t.Fatalf("code %d, body %q", rec.Code, rec.Body.String())
+	}
+}
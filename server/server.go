@@ -6,8 +6,10 @@ import (
 	"github.com/xxlixin1993/LiLGo/configure"
 	"github.com/xxlixin1993/LiLGo/graceful"
 	"github.com/xxlixin1993/LiLGo/logging"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,14 +34,37 @@ type (
 		socketLink string
 		server     *http.Server
 		context    *httpContext
+		// Plain http listener which redirects to https, see StartTLS
+		redirectServer *http.Server
+		certReloader   *certReloader
+		// Handler of server, its websocket connections are closed on stop
+		handler *EasyHandler
+		// Stops following app.debug, see followDebug
+		unwatchDebug func()
 	}
 
 	EasyHandler struct {
-		debug  bool
+		// app.debug, followed on configure reload while its HTTPServer runs
+		debug  atomic.Bool
 		pool   sync.Pool
 		router *Router
+		// Middleware executed before the router
+		premiddleware []MiddlewareFunc
+		// Middleware executed after the router
+		middleware []MiddlewareFunc
 		// Handler HTTP error
 		HTTPErrorHandler func(error, Context)
+		// Decode request data into a struct for Context.Bind
+		Binder Binder
+		// Check a bound struct for Context.Validate
+		Validator Validator
+		// Encode and decode JSON for the renderers and Context.Bind
+		JSONSerializer JSONSerializer
+		// Interval of the heartbeat of Context.SSE, 0 disables it
+		SSEHeartbeat time.Duration
+		// Alive websocket connections upgraded by the handler, closed when its
+		// HTTPServer stops
+		webSockets *webSocketManager
 	}
 
 	HTTPError struct {
@@ -52,6 +77,9 @@ type (
 
 	// HandlerFunc defines a function to server HTTP requests.
 	HandlerFunc func(Context) error
+
+	// MiddlewareFunc defines a function to process middleware.
+	MiddlewareFunc func(HandlerFunc) HandlerFunc
 )
 
 // Implement ExitInterface
@@ -61,59 +89,146 @@ func (h *HTTPServer) GetModuleName() string {
 
 // Implement ExitInterface
 func (h *HTTPServer) Stop() error {
-	quitTimeout := configure.DefaultInt("http.quit_timeout", 30)
-	ctx, _ := context.WithTimeout(context.Background(), time.Duration(quitTimeout)*time.Second)
+	return h.StopContext(context.Background())
+}
+
+// Implement ContextStopper
+// Hijacked websocket connections are not tracked by http.Server, they get a
+// close frame once the in-flight requests are drained.
+func (h *HTTPServer) StopContext(ctx context.Context) error {
+	quitTimeout := configure.DefaultDuration("http.quit_timeout", 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, quitTimeout)
+	defer cancel()
+
+	if h.certReloader != nil {
+		h.certReloader.stop()
+	}
+	if h.unwatchDebug != nil {
+		h.unwatchDebug()
+	}
+
+	err := h.server.Shutdown(ctx)
+	if h.redirectServer != nil {
+		if redirectErr := h.redirectServer.Shutdown(ctx); err == nil {
+			err = redirectErr
+		}
+	}
+	if wsErr := h.handler.webSockets.closeAll(ctx); err == nil {
+		err = wsErr
+	}
 
-	return httpServer.server.Shutdown(ctx)
+	return err
+}
+
+// Implement StageInterface
+func (h *HTTPServer) GetStopStage() int {
+	return graceful.StageServer
 }
 
 // Run http server
 func (eh *EasyHandler) StartHTTPServer() error {
+	listener, err := eh.listenHTTP()
+	if err != nil {
+		return err
+	}
+
+	// graceful exit
+	graceful.GetExitList().Register(httpServer)
+
+	serveErr := httpServer.server.Serve(listener)
+	if serveErr != nil {
+		return serveErr
+	}
+
+	return nil
+}
+
+// Build the http server and open its listener
+func (eh *EasyHandler) listenHTTP() (net.Listener, error) {
+	httpServer = eh.newHTTPServer()
+
+	listener, err := httpServer.listen()
+	if err != nil {
+		return nil, err
+	}
+	httpServer.followDebug()
+
+	return listener, nil
+}
+
+// Follow app.debug of the reloaded configure until the server stops
+func (h *HTTPServer) followDebug() {
+	eh := h.handler
+	eh.debug.Store(configure.DefaultBool("app.debug", true))
+	h.unwatchDebug = configure.Watch("app.debug", func(old, new string) {
+		eh.debug.Store(configure.DefaultBool("app.debug", true))
+	})
+}
+
+// Build the HTTPServer from app.ini
+func (eh *EasyHandler) newHTTPServer() *HTTPServer {
 	host := configure.DefaultString("host", "0.0.0.0")
 	port := configure.DefaultString("port", "80")
-	readTimeout := configure.DefaultInt("http.read_timeout", 4)
-	writeTimeout := configure.DefaultInt("http.write_timeout", 3)
+	readTimeout := configure.DefaultDuration("http.read_timeout", 4*time.Second)
+	writeTimeout := configure.DefaultDuration("http.write_timeout", 3*time.Second)
+	idleTimeout := configure.DefaultDuration("http.idle_timeout", 0)
 	socketLink := host + ":" + port
 
-	httpServer = &HTTPServer{
+	hs := &HTTPServer{
 		host:       host,
 		port:       port,
 		socketLink: socketLink,
+		handler:    eh,
 		server: &http.Server{
 			Addr:         socketLink,
 			Handler:      eh,
-			ReadTimeout:  time.Duration(readTimeout) * time.Second,
-			WriteTimeout: time.Duration(writeTimeout) * time.Second,
+			ReadTimeout:  readTimeout,
+			WriteTimeout: writeTimeout,
+			IdleTimeout:  idleTimeout,
+			// 0 or out of range values fall back to the defaults of net/http
+			HTTP2: &http.HTTP2Config{
+				MaxConcurrentStreams: configure.DefaultInt("http.h2_max_concurrent_streams", 0),
+				MaxReadFrameSize:     int(configure.DefaultBytes("http.h2_max_frame_size", 0)),
+			},
 		},
 	}
 
-	// graceful exit
-	graceful.GetExitList().Pop(httpServer)
-
-	serveErr := httpServer.server.ListenAndServe()
-	if serveErr != nil {
-		return serveErr
+	// HTTP/2 without TLS, for services behind a load balancer
+	if configure.DefaultBool("http.h2c", false) {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		hs.server.Protocols = protocols
 	}
 
-	return nil
+	return hs
 }
 
 // Implements Handler
+// The request runs through Pre middleware, then the router, then Use middleware,
+// then the route middleware and finally the matched handler. An error returned
+// from any layer is passed to HTTPErrorHandler.
 func (eh *EasyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := eh.pool.Get().(*httpContext)
 	ctx.Reset(r, w)
 
-	// TODO middleware
+	h := func(c Context) error {
+		// Pre middleware may have rewritten the request, so route on c.Request()
+		req := c.Request()
+		eh.router.Find(req.Method, getPath(req), c)
+		return applyMiddleware(c.Handler(), eh.middleware...)(c)
+	}
+	h = applyMiddleware(h, eh.premiddleware...)
 
-	h := NotFoundHandler
-	path := r.URL.RawPath
-	if path == "" {
-		path = r.URL.Path
+	err := h(ctx)
+
+	// Stop the heartbeat before the response is reused
+	if ctx.sse != nil {
+		ctx.sse.Close()
 	}
-	eh.router.Find(r.Method, getPath(r), ctx)
-	h = ctx.Handler()
 
-	if err := h(ctx); err != nil {
+	if err != nil {
 		eh.HTTPErrorHandler(err, ctx)
 	}
 
@@ -132,10 +247,16 @@ func (eh *EasyHandler) DefaultHTTPErrorHandler(err error, c Context) {
 		// Http protocol error
 		code = he.Code
 		msg = he.Message
-		if he.ExtDes != nil {
+		if ve, ok := he.ExtDes.(ValidationErrors); ok {
+			// Render per-field validation errors
+			msg = map[string]interface{}{
+				"message": he.Message,
+				"errors":  ve,
+			}
+		} else if he.ExtDes != nil {
 			msg = fmt.Sprintf("%v, %v", err, he.ExtDes)
 		}
-	} else if eh.debug {
+	} else if eh.debug.Load() {
 		// Business error
 		msg = err.Error()
 	} else {
@@ -164,23 +285,115 @@ func (eh *EasyHandler) DefaultHTTPErrorHandler(err error, c Context) {
 // Returns a instance of *httpContext
 func (eh *EasyHandler) NewHttpContext(r *http.Request, w http.ResponseWriter) *httpContext {
 	return &httpContext{
-		request:  r,
-		response: NewResponse(w),
+		request:     r,
+		response:    NewResponse(w),
+		paramValues: make([]string, eh.router.maxParam),
+		easyHandler: eh,
 	}
 }
 
-// TODO middleware
-func (eh *EasyHandler) GET(path string, h HandlerFunc) {
-	eh.router.Add(GET, path, h)
+// CONNECT registers a new CONNECT route for a path with matching handler in the router
+// with optional route-level middleware.
+func (eh *EasyHandler) CONNECT(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	eh.Add(CONNECT, path, h, m...)
+}
+
+// DELETE registers a new DELETE route for a path with matching handler in the router
+// with optional route-level middleware.
+func (eh *EasyHandler) DELETE(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	eh.Add(DELETE, path, h, m...)
+}
+
+// GET registers a new GET route for a path with matching handler in the router
+// with optional route-level middleware.
+func (eh *EasyHandler) GET(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	eh.Add(GET, path, h, m...)
+}
+
+// HEAD registers a new HEAD route for a path with matching handler in the router
+// with optional route-level middleware.
+func (eh *EasyHandler) HEAD(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	eh.Add(HEAD, path, h, m...)
+}
+
+// OPTIONS registers a new OPTIONS route for a path with matching handler in the router
+// with optional route-level middleware.
+func (eh *EasyHandler) OPTIONS(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	eh.Add(OPTIONS, path, h, m...)
+}
+
+// PATCH registers a new PATCH route for a path with matching handler in the router
+// with optional route-level middleware.
+func (eh *EasyHandler) PATCH(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	eh.Add(PATCH, path, h, m...)
+}
+
+// POST registers a new POST route for a path with matching handler in the router
+// with optional route-level middleware.
+func (eh *EasyHandler) POST(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	eh.Add(POST, path, h, m...)
+}
+
+// PUT registers a new PUT route for a path with matching handler in the router
+// with optional route-level middleware.
+func (eh *EasyHandler) PUT(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	eh.Add(PUT, path, h, m...)
+}
+
+// TRACE registers a new TRACE route for a path with matching handler in the router
+// with optional route-level middleware.
+func (eh *EasyHandler) TRACE(path string, h HandlerFunc, m ...MiddlewareFunc) {
+	eh.Add(TRACE, path, h, m...)
+}
+
+// Any registers a new route for all supported HTTP methods and path with matching handler
+// in the router with optional route-level middleware.
+func (eh *EasyHandler) Any(path string, h HandlerFunc, middleware ...MiddlewareFunc) {
+	for _, m := range allowMethods {
+		eh.Add(m, path, h, middleware...)
+	}
+}
+
+// Match registers a new route for multiple HTTP methods and path with matching handler
+// in the router with optional route-level middleware.
+func (eh *EasyHandler) Match(methods []string, path string, h HandlerFunc, middleware ...MiddlewareFunc) {
+	for _, m := range methods {
+		eh.Add(m, path, h, middleware...)
+	}
+}
+
+// Add registers a new route for an HTTP method and path with matching handler
+// in the router with optional route-level middleware.
+func (eh *EasyHandler) Add(method, path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	h := applyMiddleware(handler, middleware...)
+	eh.router.Add(method, path, h)
+}
+
+// Pre adds middleware to the chain which is run before router.
+// Pre middleware run in the order they were added, so the first one is the outermost.
+func (eh *EasyHandler) Pre(middleware ...MiddlewareFunc) {
+	eh.premiddleware = append(eh.premiddleware, middleware...)
+}
+
+// Use adds middleware to the chain which is run after router.
+// Use middleware run in the order they were added, after every Pre middleware
+// and before any route-level middleware.
+func (eh *EasyHandler) Use(middleware ...MiddlewareFunc) {
+	eh.middleware = append(eh.middleware, middleware...)
 }
 
 // Returns a instance of *EasyHandler
 func NewEasyHandler() *EasyHandler {
 	eh := &EasyHandler{
-		router: NewRouter(),
-		debug:  configure.DefaultBool("app.debug", true),
+		router:     NewRouter(),
+		webSockets: newWebSocketManager(),
 	}
+	eh.debug.Store(configure.DefaultBool("app.debug", true))
 	eh.HTTPErrorHandler = eh.DefaultHTTPErrorHandler
+	eh.Binder = &DefaultBinder{}
+	eh.Validator = &DefaultValidator{}
+	eh.JSONSerializer = DefaultJSONSerializer{}
+	eh.SSEHeartbeat = defaultSSEHeartbeat
 	eh.pool.New = func() interface{} {
 		return eh.NewHttpContext(nil, nil)
 	}
@@ -196,6 +409,14 @@ func NewHTTPError(code int, message ...interface{}) *HTTPError {
 	return he
 }
 
+// Wraps h with middleware so that middleware[0] is the outermost layer.
+func applyMiddleware(h HandlerFunc, middleware ...MiddlewareFunc) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
 func getPath(r *http.Request) string {
 	path := r.URL.RawPath
 	if path == "" {
@@ -204,6 +425,12 @@ func getPath(r *http.Request) string {
 	return path
 }
 
+// Set the extended description and return the HTTPError itself.
+func (he *HTTPError) setExtDes(err error) *HTTPError {
+	he.ExtDes = err
+	return he
+}
+
 // Error makes it compatible with `error` interface.
 func (he *HTTPError) Error() string {
 	return fmt.Sprintf("code=%d, message=%v", he.Code, he.Message)
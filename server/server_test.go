@@ -0,0 +1,127 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Records the name of every layer the request runs through
+type trace struct {
+	layers []string
+}
+
+func (tr *trace) middleware(name string) MiddlewareFunc {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(c Context) error {
+			tr.layers = append(tr.layers, name+"("+c.Path()+")")
+			return next(c)
+		}
+	}
+}
+
+func (tr *trace) handler(name string) HandlerFunc {
+	return func(c Context) error {
+		tr.layers = append(tr.layers, name)
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	tr := &trace{}
+	eh := NewEasyHandler()
+	eh.Use(tr.middleware("use1"))
+	eh.Pre(tr.middleware("pre1"), tr.middleware("pre2"))
+	eh.Use(tr.middleware("use2"))
+	// Rewrites the path before routing
+	eh.Pre(func(next HandlerFunc) HandlerFunc {
+		return func(c Context) error {
+			if c.Request().URL.Path == "/old" {
+				c.Request().URL.Path = "/new"
+			}
+			return next(c)
+		}
+	})
+	eh.GET("/new", tr.handler("new"), tr.middleware("route1"), tr.middleware("route2"))
+	eh.GET("/other", tr.handler("other"))
+
+	tests := []struct {
+		method string
+		target string
+		code   int
+		layers string
+	}{
+		// Pre runs before the route is found, Use and route middleware after
+		{GET, "/old", http.StatusNoContent, "pre1(),pre2(),use1(/new),use2(/new),route1(/new),route2(/new),new"},
+		{GET, "/other", http.StatusNoContent, "pre1(),pre2(),use1(/other),use2(/other),other"},
+		// Use wraps the not found and method not allowed handlers too
+		{GET, "/missing", http.StatusNotFound, "pre1(),pre2(),use1(/missing),use2(/missing)"},
+		{POST, "/new", http.StatusMethodNotAllowed, "pre1(),pre2(),use1(/new),use2(/new)"},
+	}
+
+	for _, tt := range tests {
+		tr.layers = nil
+		rec := serve(eh, tt.method, tt.target)
+		if rec.Code != tt.code {
+			t.Errorf("%s %s: code = %d, want %d", tt.method, tt.target, rec.Code, tt.code)
+		}
+		if got := strings.Join(tr.layers, ","); got != tt.layers {
+			t.Errorf("%s %s: layers = %s, want %s", tt.method, tt.target, got, tt.layers)
+		}
+	}
+}
+
+func TestMiddlewareErrorHandler(t *testing.T) {
+	// Fails the request in the layer called name
+	fail := func(name string, err error) func(string) MiddlewareFunc {
+		return func(layer string) MiddlewareFunc {
+			return func(next HandlerFunc) HandlerFunc {
+				return func(c Context) error {
+					if layer == name {
+						return err
+					}
+					return next(c)
+				}
+			}
+		}
+	}
+
+	tests := []struct {
+		layer string
+		err   error
+		code  int
+	}{
+		{"pre", NewHTTPError(http.StatusUnauthorized), http.StatusUnauthorized},
+		{"use", NewHTTPError(http.StatusForbidden), http.StatusForbidden},
+		{"route", NewHTTPError(http.StatusTooManyRequests), http.StatusTooManyRequests},
+		{"handler", errors.New("business error"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		mw := fail(tt.layer, tt.err)
+		eh := NewEasyHandler()
+		eh.Pre(mw("pre"))
+		eh.Use(mw("use"))
+		eh.GET("/", func(c Context) error {
+			if tt.layer == "handler" {
+				return tt.err
+			}
+			return c.NoContent(http.StatusNoContent)
+		}, mw("route"))
+
+		var handled error
+		eh.HTTPErrorHandler = func(err error, c Context) {
+			handled = err
+			eh.DefaultHTTPErrorHandler(err, c)
+		}
+
+		rec := serve(eh, GET, "/")
+		if handled != tt.err {
+			t.Errorf("%s: HTTPErrorHandler got %v, want %v", tt.layer, handled, tt.err)
+		}
+		if rec.Code != tt.code {
+			t.Errorf("%s: code = %d, want %d", tt.layer, rec.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MIMETextEventStream = "text/event-stream"
+
+	HeaderCacheControl = "Cache-Control"
+	HeaderLastEventID  = "Last-Event-ID"
+	// Tell nginx not to buffer the stream
+	HeaderXAccelBuffering = "X-Accel-Buffering"
+)
+
+// Default EasyHandler.SSEHeartbeat
+const defaultSSEHeartbeat = 15 * time.Second
+
+var (
+	ErrSSEClosed       = errors.New("sse: stream closed")
+	ErrSSENotSupported = errors.New("sse: response does not implement http.Flusher")
+)
+
+type (
+	// Event is a server-sent event. Empty fields are not written.
+	Event struct {
+		ID    string
+		Event string
+		// Data may contain several lines
+		Data string
+		// Reconnection time of the client
+		Retry time.Duration
+	}
+
+	// SSEWriter writes server-sent events to the response. It is safe for
+	// concurrent use. It is closed when the handler returns, as the response
+	// is reused by another request afterwards.
+	SSEWriter struct {
+		mu       sync.Mutex
+		response *Response
+		request  *http.Request
+
+		// Closed when the client is gone or the writer is closed
+		done      chan struct{}
+		doneOnce  sync.Once
+		stop      chan struct{}
+		stopOnce  sync.Once
+		heartbeat sync.WaitGroup
+	}
+)
+
+// Starts an event stream. A heartbeat comment is sent every EasyHandler.SSEHeartbeat
+// so proxies keep the connection open and a gone client is noticed.
+func (hc *httpContext) SSE() (*SSEWriter, error) {
+	if _, ok := hc.response.Writer.(http.Flusher); !ok {
+		return nil, ErrSSENotSupported
+	}
+
+	// The stream outlives http.write_timeout
+	http.NewResponseController(hc.response.Writer).SetWriteDeadline(time.Time{})
+
+	header := hc.response.Header()
+	header.Set(HeaderContentType, MIMETextEventStream)
+	header.Set(HeaderCacheControl, "no-cache")
+	header.Set(HeaderConnection, "keep-alive")
+	header.Set(HeaderXAccelBuffering, "no")
+	hc.response.WriteHeader(http.StatusOK)
+	hc.response.Flush()
+
+	sw := &SSEWriter{
+		response: hc.response,
+		request:  hc.request,
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+
+	hc.sse = sw
+	sw.heartbeat.Add(1)
+	go sw.run(hc.easyHandler.SSEHeartbeat)
+
+	return sw, nil
+}
+
+// LastEventID returns the id of the last event the client received before it
+// reconnected, or "" for a new stream.
+func (sw *SSEWriter) LastEventID() string {
+	return sw.request.Header.Get(HeaderLastEventID)
+}
+
+// Done returns a channel which is closed when the client disconnects, a write
+// fails or the writer is closed.
+func (sw *SSEWriter) Done() <-chan struct{} {
+	return sw.done
+}
+
+// Send writes an event and flushes it to the client.
+func (sw *SSEWriter) Send(e *Event) error {
+	var b strings.Builder
+
+	if e.ID != "" {
+		if strings.ContainsAny(e.ID, "\r\n\x00") {
+			return errors.New("sse: id must not contain newline or NUL")
+		}
+		b.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		if strings.ContainsAny(e.Event, "\r\n") {
+			return errors.New("sse: event must not contain newline")
+		}
+		b.WriteString("event: " + e.Event + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(int64(e.Retry/time.Millisecond), 10) + "\n")
+	}
+
+	// Every line of data is a data field, the client joins them with "\n"
+	data := strings.ReplaceAll(strings.ReplaceAll(e.Data, "\r\n", "\n"), "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	return sw.write(b.String())
+}
+
+// Comment writes a comment line, which is ignored by the client.
+func (sw *SSEWriter) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	return sw.write(b.String())
+}
+
+// Close stops the heartbeat and waits for a write in progress. Nothing is written
+// to the response afterwards.
+func (sw *SSEWriter) Close() {
+	sw.stopOnce.Do(func() {
+		close(sw.stop)
+	})
+	sw.heartbeat.Wait()
+	sw.closeDone()
+}
+
+func (sw *SSEWriter) write(s string) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	select {
+	case <-sw.done:
+		return ErrSSEClosed
+	default:
+	}
+
+	if _, err := sw.response.Write([]byte(s)); err != nil {
+		sw.closeDoneLocked()
+		return err
+	}
+	sw.response.Flush()
+
+	return nil
+}
+
+// Send heartbeats until the client is gone or the writer is closed
+func (sw *SSEWriter) run(interval time.Duration) {
+	defer sw.heartbeat.Done()
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			if sw.Comment("heartbeat") != nil {
+				return
+			}
+		case <-sw.request.Context().Done():
+			sw.closeDone()
+			return
+		case <-sw.stop:
+			return
+		case <-sw.done:
+			return
+		}
+	}
+}
+
+// Close done once no write is in progress
+func (sw *SSEWriter) closeDone() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.closeDoneLocked()
+}
+
+// Close done, sw.mu is held
+func (sw *SSEWriter) closeDoneLocked() {
+	sw.doneOnce.Do(func() {
+		close(sw.done)
+	})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Counts the writes made after ServeHTTP returned
+type lateWriteRecorder struct {
+	*httptest.ResponseRecorder
+	served atomic.Bool
+	late   atomic.Int32
+}
+
+func (lr *lateWriteRecorder) Write(b []byte) (int, error) {
+	if lr.served.Load() {
+		lr.late.Add(1)
+	}
+	return lr.ResponseRecorder.Write(b)
+}
+
+func TestSSESendWhileHandlerReturns(t *testing.T) {
+	eh := NewEasyHandler()
+	eh.SSEHeartbeat = 0
+
+	sent := make(chan error, 1)
+	eh.GET("/events", func(c Context) error {
+		sw, err := c.SSE()
+		if err != nil {
+			return err
+		}
+
+		started := make(chan struct{})
+		go func() {
+			close(started)
+			for {
+				if err := sw.Send(&Event{Data: "tick"}); err != nil {
+					sent <- err
+					return
+				}
+			}
+		}()
+		<-started
+
+		return nil
+	})
+
+	for i := 0; i < 50; i++ {
+		lr := &lateWriteRecorder{ResponseRecorder: httptest.NewRecorder()}
+		eh.ServeHTTP(lr, httptest.NewRequest(http.MethodGet, "/events", nil))
+		lr.served.Store(true)
+
+		if err := <-sent; err != ErrSSEClosed {
+			t.Fatalf("Send error = %v, want %v", err, ErrSSEClosed)
+		}
+		if n := lr.late.Load(); n != 0 {
+			t.Fatalf("%d writes after ServeHTTP returned", n)
+		}
+	}
+}
@@ -0,0 +1,484 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xxlixin1993/LiLGo/configure"
+	"github.com/xxlixin1993/LiLGo/graceful"
+	"github.com/xxlixin1993/LiLGo/logging"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const KTcpServerModuleName = "tcpServerModule"
+
+// Server type, server.support in app.ini
+const (
+	SupportHTTP = "http"
+	SupportTCP  = "tcp"
+)
+
+var ErrConnClosed = errors.New("tcp: connection closed")
+
+type (
+	TCPServer struct {
+		host        string
+		port        string
+		socketLink  string
+		config      TCPConfig
+		listener    net.Listener
+		codec       Codec
+		connManager *ConnManager
+		// Handle may be called while the connections read handlers
+		handlersMu sync.RWMutex
+		handlers   map[uint32]TCPHandlerFunc
+		// Closed when the server starts to exit
+		quit     chan struct{}
+		quitOnce sync.Once
+		// Running connections, mu orders wg.Add in serve before wg.Wait on exit
+		mu sync.Mutex
+		wg sync.WaitGroup
+	}
+
+	// TCPConn is a client connection of the TCPServer.
+	TCPConn struct {
+		id     uint64
+		conn   net.Conn
+		server *TCPServer
+		// Messages waiting to be written
+		sendChan chan *Message
+		// Closed when the connection starts to close
+		closing   chan struct{}
+		closeOnce sync.Once
+	}
+
+	// ConnManager keeps all alive connections of a TCPServer.
+	ConnManager struct {
+		mu    sync.RWMutex
+		conns map[uint64]*TCPConn
+		// Connection id generator
+		seq uint64
+	}
+
+	// TCPHandlerFunc defines a function to serve a TCP message.
+	TCPHandlerFunc func(*TCPConn, *Message) error
+
+	// TCPConfig is tcp.* of app.ini.
+	TCPConfig struct {
+		// Max idle time of a connection, 0 means no limit
+		ReadTimeout  time.Duration `config:"read_timeout" default:"0"`
+		WriteTimeout time.Duration `config:"write_timeout" default:"3s"`
+		QuitTimeout  time.Duration `config:"quit_timeout" default:"30s"`
+		// Max alive connections, 0 means no limit
+		MaxConn int `config:"max_conn" default:"0"`
+		// Frame of the default LengthFieldCodec
+		LengthSize     int    `config:"length_size" default:"4"`
+		ByteOrder      string `config:"byte_order" default:"big"`
+		MaxFrameLength uint64 `config:"max_frame_length,size" default:"64KB"`
+	}
+)
+
+const (
+	// Size of the queue of messages waiting to be written, per connection
+	sendQueueSize = 64
+)
+
+// Implement ExitInterface
+func (ts *TCPServer) GetModuleName() string {
+	return KTcpServerModuleName
+}
+
+// Implement ExitInterface
+func (ts *TCPServer) Stop() error {
+	return ts.StopContext(context.Background())
+}
+
+// Implement ContextStopper
+// Stop accepting, let every connection finish the message in hand and flush the
+// queued replies. Connections still alive after tcp.quit_timeout are closed.
+func (ts *TCPServer) StopContext(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, ts.config.QuitTimeout)
+	defer cancel()
+
+	var err error
+	ts.quitOnce.Do(func() {
+		close(ts.quit)
+		err = ts.listener.Close()
+	})
+
+	// Connections accepted from now on see ts.quit and are closed in serve
+	ts.mu.Lock()
+	ts.mu.Unlock()
+
+	// Unblock the readers, see TCPConn.readLoop
+	ts.connManager.Range(func(c *TCPConn) {
+		c.conn.SetReadDeadline(time.Now())
+	})
+
+	done := make(chan struct{})
+	go func() {
+		ts.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		alive := ts.connManager.Len()
+		ts.connManager.Range(func(c *TCPConn) {
+			c.conn.Close()
+		})
+		return fmt.Errorf("tcp: %d connections still alive: %v", alive, ctx.Err())
+	}
+
+	return err
+}
+
+// Implement StageInterface
+func (ts *TCPServer) GetStopStage() int {
+	return graceful.StageServer
+}
+
+// Returns a instance of *TCPServer
+func NewTCPServer() *TCPServer {
+	return &TCPServer{
+		handlers:    make(map[uint32]TCPHandlerFunc),
+		connManager: NewConnManager(),
+		quit:        make(chan struct{}),
+	}
+}
+
+// Handle registers the handler for the message id, also while the server runs.
+func (ts *TCPServer) Handle(id uint32, h TCPHandlerFunc) {
+	if h == nil {
+		panic("tcp: nil handler")
+	}
+
+	ts.handlersMu.Lock()
+	defer ts.handlersMu.Unlock()
+
+	if _, ok := ts.handlers[id]; ok {
+		panic(fmt.Sprintf("tcp: handler of message %d already registered", id))
+	}
+	ts.handlers[id] = h
+}
+
+// Handler registered for the message id
+func (ts *TCPServer) handler(id uint32) (TCPHandlerFunc, bool) {
+	ts.handlersMu.RLock()
+	defer ts.handlersMu.RUnlock()
+
+	h, ok := ts.handlers[id]
+	return h, ok
+}
+
+// SetCodec sets the framing codec, it must be called before StartTCPServer.
+// By default a LengthFieldCodec is built from the tcp.* keys of app.ini.
+func (ts *TCPServer) SetCodec(codec Codec) {
+	ts.codec = codec
+}
+
+// ConnManager returns the manager of alive connections.
+func (ts *TCPServer) ConnManager() *ConnManager {
+	return ts.connManager
+}
+
+// Run tcp server
+func (ts *TCPServer) StartTCPServer() error {
+	if err := ts.listen(); err != nil {
+		return err
+	}
+
+	// graceful exit
+	graceful.GetExitList().Register(ts)
+
+	return ts.serve()
+}
+
+// Load app.ini and open the listener
+func (ts *TCPServer) listen() error {
+	ts.host = configure.DefaultString("host", "0.0.0.0")
+	ts.port = configure.DefaultString("port", "80")
+	ts.socketLink = ts.host + ":" + ts.port
+	if err := configure.Unmarshal("tcp", &ts.config); err != nil {
+		return err
+	}
+
+	if ts.codec == nil {
+		codec, err := NewLengthFieldCodec(ts.config.LengthSize, ts.config.ByteOrder, ts.config.MaxFrameLength)
+		if err != nil {
+			return err
+		}
+		ts.codec = codec
+	}
+
+	listener, err := inheritOrListen(TCPListenerName, func() (net.Listener, error) {
+		return net.Listen("tcp", ts.socketLink)
+	})
+	if err != nil {
+		return err
+	}
+	ts.listener = listener
+
+	return nil
+}
+
+// Accept connections until the listener is closed
+func (ts *TCPServer) serve() error {
+	var tempDelay time.Duration
+
+	for {
+		conn, err := ts.listener.Accept()
+		if err != nil {
+			select {
+			case <-ts.quit:
+				return nil
+			default:
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				// Back off like net/http does
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if tempDelay > time.Second {
+					tempDelay = time.Second
+				}
+				logging.WarningF("tcp: accept error: %v; retrying in %v", err, tempDelay)
+				time.Sleep(tempDelay)
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+
+		if ts.config.MaxConn > 0 && ts.connManager.Len() >= ts.config.MaxConn {
+			logging.WarningF("tcp: too many connections(%d), refuse %s", ts.config.MaxConn, conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		ts.mu.Lock()
+		select {
+		case <-ts.quit:
+			ts.mu.Unlock()
+			conn.Close()
+			return nil
+		default:
+		}
+		c := ts.newConn(conn)
+		ts.wg.Add(1)
+		ts.mu.Unlock()
+
+		go c.serve()
+	}
+}
+
+func (ts *TCPServer) newConn(conn net.Conn) *TCPConn {
+	c := &TCPConn{
+		conn:     conn,
+		server:   ts,
+		sendChan: make(chan *Message, sendQueueSize),
+		closing:  make(chan struct{}),
+	}
+	ts.connManager.Add(c)
+	return c
+}
+
+// ID returns the unique id of the connection.
+func (c *TCPConn) ID() uint64 {
+	return c.id
+}
+
+// RemoteAddr returns the remote network address.
+func (c *TCPConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// Send queues the message to be written to the connection.
+func (c *TCPConn) Send(msg *Message) error {
+	select {
+	case <-c.closing:
+		return ErrConnClosed
+	default:
+	}
+
+	select {
+	case c.sendChan <- msg:
+		return nil
+	case <-c.closing:
+		return ErrConnClosed
+	}
+}
+
+// Reply sends body as the response of req, with the same command id and sequence.
+func (c *TCPConn) Reply(req *Message, body []byte) error {
+	return c.Send(&Message{MessageHeader: req.MessageHeader, Body: body})
+}
+
+// Close closes the connection after the queued messages are written.
+func (c *TCPConn) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		c.server.connManager.Remove(c)
+	})
+}
+
+func (c *TCPConn) serve() {
+	written := make(chan struct{})
+	go func() {
+		c.writeLoop()
+		close(written)
+	}()
+
+	c.readLoop()
+	c.Close()
+
+	<-written
+	c.server.wg.Done()
+}
+
+// Read messages and dispatch them one by one, so a connection is served in order
+func (c *TCPConn) readLoop() {
+	reader := bufio.NewReader(c.conn)
+
+	for {
+		var deadline time.Time
+		if c.server.config.ReadTimeout > 0 {
+			deadline = time.Now().Add(c.server.config.ReadTimeout)
+		}
+		c.conn.SetReadDeadline(deadline)
+
+		// Checked after setting the deadline so that Stop can not be overwritten
+		select {
+		case <-c.server.quit:
+			return
+		case <-c.closing:
+			return
+		default:
+		}
+
+		msg, err := c.server.codec.Decode(reader)
+		if err != nil {
+			if errors.Is(err, ErrFrameTooLarge) {
+				logging.ErrorF("tcp: close %s: %v", c.conn.RemoteAddr(), err)
+				return
+			}
+
+			select {
+			case <-c.server.quit:
+			case <-c.closing:
+			default:
+				if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+					logging.DebugF("tcp: read %s error: %v", c.conn.RemoteAddr(), err)
+				}
+			}
+			return
+		}
+
+		h, ok := c.server.handler(msg.ID)
+		if !ok {
+			logging.WarningF("tcp: unknown message id %d from %s", msg.ID, c.conn.RemoteAddr())
+			continue
+		}
+		if err = h(c, msg); err != nil {
+			logging.ErrorF("tcp: handle message %d from %s error: %v", msg.ID, c.conn.RemoteAddr(), err)
+		}
+	}
+}
+
+// Write queued messages until the connection is closing, then flush the rest
+func (c *TCPConn) writeLoop() {
+	defer c.conn.Close()
+
+	for {
+		select {
+		case msg := <-c.sendChan:
+			if err := c.write(msg); err != nil {
+				c.Close()
+				return
+			}
+		case <-c.closing:
+			for {
+				select {
+				case msg := <-c.sendChan:
+					if err := c.write(msg); err != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *TCPConn) write(msg *Message) error {
+	b, err := c.server.codec.Encode(msg)
+	if err != nil {
+		logging.ErrorF("tcp: encode message %d error: %v", msg.ID, err)
+		return nil
+	}
+
+	if c.server.config.WriteTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.server.config.WriteTimeout))
+	}
+	if _, err = c.conn.Write(b); err != nil {
+		logging.DebugF("tcp: write %s error: %v", c.conn.RemoteAddr(), err)
+	}
+	return err
+}
+
+// Returns a instance of *ConnManager
+func NewConnManager() *ConnManager {
+	return &ConnManager{
+		conns: make(map[uint64]*TCPConn),
+	}
+}
+
+// Add a connection and give it an unique id
+func (cm *ConnManager) Add(c *TCPConn) {
+	c.id = atomic.AddUint64(&cm.seq, 1)
+
+	cm.mu.Lock()
+	cm.conns[c.id] = c
+	cm.mu.Unlock()
+}
+
+// Remove a connection
+func (cm *ConnManager) Remove(c *TCPConn) {
+	cm.mu.Lock()
+	delete(cm.conns, c.id)
+	cm.mu.Unlock()
+}
+
+// Get a connection by id
+func (cm *ConnManager) Get(id uint64) (*TCPConn, bool) {
+	cm.mu.RLock()
+	c, ok := cm.conns[id]
+	cm.mu.RUnlock()
+	return c, ok
+}
+
+// Len returns the number of alive connections.
+func (cm *ConnManager) Len() int {
+	cm.mu.RLock()
+	n := len(cm.conns)
+	cm.mu.RUnlock()
+	return n
+}
+
+// Range calls fn for every alive connection. fn must not add or remove connections.
+func (cm *ConnManager) Range(fn func(c *TCPConn)) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	for _, c := range cm.conns {
+		fn(c)
+	}
+}
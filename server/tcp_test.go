@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+)
+
+func TestTCPServerHandleWhileServing(t *testing.T) {
+	ts := NewTCPServer()
+	noop := func(*TCPConn, *Message) error { return nil }
+
+	// Registers while the connections look the handlers up, see -race
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for id := uint32(0); id < 100; id++ {
+			ts.Handle(id, noop)
+		}
+	}()
+	for id := uint32(0); id < 100; id++ {
+		ts.handler(id)
+	}
+	<-done
+
+	for id := uint32(0); id < 100; id++ {
+		if _, ok := ts.handler(id); !ok {
+			t.Errorf("handler of message %d not registered", id)
+		}
+	}
+	if _, ok := ts.handler(100); ok {
+		t.Error("handler of message 100 found")
+	}
+}
+
+func TestTCPServerHandleTwice(t *testing.T) {
+	ts := NewTCPServer()
+	noop := func(*TCPConn, *Message) error { return nil }
+	ts.Handle(1, noop)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Handle of a registered message id did not panic")
+		}
+	}()
+	ts.Handle(1, noop)
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/xxlixin1993/LiLGo/configure"
+	"github.com/xxlixin1993/LiLGo/graceful"
+	"github.com/xxlixin1993/LiLGo/logging"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Client certificate verification, http.tls_client_auth in app.ini
+const (
+	ClientAuthRequire       = "require"
+	ClientAuthVerifyIfGiven = "verify_if_given"
+)
+
+// certReloader serves the certificate to new TLS handshakes and reloads it
+// from disk on SIGHUP. Established connections are not affected.
+type certReloader struct {
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certFile string
+	keyFile  string
+	sigChan  chan os.Signal
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// Run https server
+// The certificate and key are http.tls_cert and http.tls_key. When http.tls_client_ca
+// is set clients must present a certificate signed by it. When http.tls_redirect_port
+// is set, a plain http listener on that port redirects to https.
+func (eh *EasyHandler) StartTLS() error {
+	listener, err := eh.listenTLS()
+	if err != nil {
+		return err
+	}
+
+	// graceful exit
+	graceful.GetExitList().Register(httpServer)
+
+	serveErr := httpServer.server.ServeTLS(listener, "", "")
+	if serveErr != nil {
+		return serveErr
+	}
+
+	return nil
+}
+
+// Build the https server, open its listener and start the redirect listener
+func (eh *EasyHandler) listenTLS() (net.Listener, error) {
+	certFile := configure.DefaultString("http.tls_cert", "")
+	keyFile := configure.DefaultString("http.tls_key", "")
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("tls: http.tls_cert and http.tls_key are required")
+	}
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+
+	if caFile := configure.DefaultString("http.tls_client_ca", ""); caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+
+		switch clientAuth := configure.DefaultString("http.tls_client_auth", ClientAuthRequire); clientAuth {
+		case ClientAuthRequire:
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		case ClientAuthVerifyIfGiven:
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("tls: unknown http.tls_client_auth %q", clientAuth)
+		}
+	}
+
+	httpServer = eh.newHTTPServer()
+	httpServer.server.TLSConfig = tlsConfig
+	httpServer.certReloader = reloader
+
+	listener, err := httpServer.listen()
+	if err != nil {
+		return nil, err
+	}
+
+	if redirectPort := configure.DefaultString("http.tls_redirect_port", ""); redirectPort != "" {
+		httpServer.redirectServer = &http.Server{
+			Addr:         net.JoinHostPort(httpServer.host, redirectPort),
+			Handler:      redirectHTTPSHandler(httpServer.port),
+			ReadTimeout:  httpServer.server.ReadTimeout,
+			WriteTimeout: httpServer.server.WriteTimeout,
+		}
+		redirectListener, err := inheritOrListen(HTTPSRedirectListenerName, func() (net.Listener, error) {
+			return net.Listen("tcp", httpServer.redirectServer.Addr)
+		})
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		go func(s *http.Server) {
+			if err := s.Serve(redirectListener); err != nil && err != http.ErrServerClosed {
+				logging.ErrorF("tls: redirect listener %s error: %v", s.Addr, err)
+			}
+		}(httpServer.redirectServer)
+	}
+
+	httpServer.followDebug()
+	go reloader.watch()
+
+	return listener, nil
+}
+
+// Redirect every request to the same host and uri over https with 301
+func redirectHTTPSHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			// An IPv6 host without port, e.g. [::1]
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: read client ca: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tls: no certificate found in %s", caFile)
+	}
+	return pool, nil
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		sigChan:  make(chan os.Signal, 1),
+		quit:     make(chan struct{}),
+	}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// Implements tls.Config.GetCertificate
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// Load the key pair, the old one is kept when it fails
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("tls: load key pair: %v", err)
+	}
+
+	cr.mu.Lock()
+	cr.cert = &cert
+	cr.mu.Unlock()
+	return nil
+}
+
+// Reload on SIGHUP until stop is called
+func (cr *certReloader) watch() {
+	signal.Notify(cr.sigChan, syscall.SIGHUP)
+	defer signal.Stop(cr.sigChan)
+
+	for {
+		select {
+		case <-cr.sigChan:
+			if err := cr.reload(); err != nil {
+				logging.ErrorF("%v, keep the old certificate", err)
+				continue
+			}
+			logging.Info("tls: certificate reloaded")
+		case <-cr.quit:
+			return
+		}
+	}
+}
+
+func (cr *certReloader) stop() {
+	cr.stopOnce.Do(func() {
+		close(cr.quit)
+	})
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectHTTPSHandler(t *testing.T) {
+	tests := []struct {
+		host      string
+		httpsPort string
+		want      string
+	}{
+		{"example.com", "443", "https://example.com/a?b=1"},
+		{"example.com:80", "443", "https://example.com/a?b=1"},
+		{"example.com:8080", "8443", "https://example.com:8443/a?b=1"},
+		{"127.0.0.1:80", "8443", "https://127.0.0.1:8443/a?b=1"},
+		{"[::1]:80", "8443", "https://[::1]:8443/a?b=1"},
+		{"[::1]", "8443", "https://[::1]:8443/a?b=1"},
+		{"[::1]:80", "443", "https://[::1]/a?b=1"},
+		{"[::1]", "443", "https://[::1]/a?b=1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/a?b=1", nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		redirectHTTPSHandler(tt.httpsPort).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusMovedPermanently {
+			t.Errorf("%s to %s: code = %d, want %d", tt.host, tt.httpsPort, rec.Code, http.StatusMovedPermanently)
+		}
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s to %s: Location = %q, want %q", tt.host, tt.httpsPort, got, tt.want)
+		}
+	}
+}
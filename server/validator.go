@@ -0,0 +1,319 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Struct tag used by DefaultValidator
+const ValidateTag = "validate"
+
+type (
+	// Validator is the interface that wraps the Validate function.
+	Validator interface {
+		Validate(i interface{}) error
+	}
+
+	// DefaultValidator is a tag based implementation of the Validator interface.
+	// Rules are separated by comma in the `validate` tag, for example
+	//   Name  string `json:"name" validate:"required,min=2,max=32"`
+	//   Kind  string `validate:"oneof=user admin"`
+	//   Email string `validate:"email"`
+	//   Code  string `validate:"len=6,regexp=^[0-9]+$"`
+	// Supported rules: required, min, max, len, oneof, regexp, email.
+	// min, max and len compare numbers by value and strings, slices and maps by length.
+	// regexp takes the rest of the tag, so it must be the last rule.
+	DefaultValidator struct {
+		// Compiled regexp cache, pattern => *regexp.Regexp
+		regexps sync.Map
+	}
+
+	// ValidationErrors maps a field name to the reason it failed validation.
+	ValidationErrors map[string]string
+)
+
+// Validate implements the Validator#Validate function.
+// It returns ValidationErrors when one or more fields are invalid.
+func (v *DefaultValidator) Validate(i interface{}) error {
+	val := reflect.ValueOf(i)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return errors.New("validation element must not be nil")
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return errors.New("validation element must be a struct")
+	}
+
+	errs := make(ValidationErrors)
+	if err := v.validateStruct(val, "", errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// Validate every exported field of the struct, nested structs are prefixed by "parent."
+func (v *DefaultValidator) validateStruct(val reflect.Value, prefix string, errs ValidationErrors) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		typeField := typ.Field(i)
+		if typeField.PkgPath != "" && !typeField.Anonymous {
+			// unexported
+			continue
+		}
+
+		name := prefix + fieldName(typeField)
+		field := val.Field(i)
+
+		if tag := typeField.Tag.Get(ValidateTag); tag != "" && tag != "-" {
+			msg, err := v.validateField(field, tag)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			if msg != "" {
+				errs[name] = msg
+				continue
+			}
+		}
+
+		// Go deeper
+		for field.Kind() == reflect.Ptr && !field.IsNil() {
+			field = field.Elem()
+		}
+		switch field.Kind() {
+		case reflect.Struct:
+			// Embedded struct fields are promoted, so they keep the current prefix
+			nested := prefix
+			if !typeField.Anonymous {
+				nested = name + "."
+			}
+			if err := v.validateStruct(field, nested, errs); err != nil {
+				return err
+			}
+		case reflect.Slice, reflect.Array:
+			for j := 0; j < field.Len(); j++ {
+				elem := field.Index(j)
+				for elem.Kind() == reflect.Ptr && !elem.IsNil() {
+					elem = elem.Elem()
+				}
+				if elem.Kind() != reflect.Struct {
+					break
+				}
+				if err := v.validateStruct(elem, name+"["+strconv.Itoa(j)+"].", errs); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Check a field against its rules. It returns the failure reason, or an error
+// when the tag itself is malformed.
+func (v *DefaultValidator) validateField(field reflect.Value, tag string) (string, error) {
+	// A pointer satisfies required when it is not nil, a nil pointer skips other rules
+	isPtr := field.Kind() == reflect.Ptr
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			if hasRule(tag, "required") {
+				return "is required", nil
+			}
+			return "", nil
+		}
+		field = field.Elem()
+	}
+
+	for tag != "" {
+		var rule string
+		if strings.HasPrefix(tag, "regexp=") {
+			rule, tag = tag, ""
+		} else if n := strings.IndexByte(tag, ','); n >= 0 {
+			rule, tag = tag[:n], tag[n+1:]
+		} else {
+			rule, tag = tag, ""
+		}
+
+		name, param := rule, ""
+		if n := strings.IndexByte(rule, '='); n >= 0 {
+			name, param = rule[:n], rule[n+1:]
+		}
+
+		var (
+			msg string
+			err error
+		)
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "required":
+			if !isPtr && field.IsZero() {
+				msg = "is required"
+			}
+		case "min":
+			msg, err = compareField(field, param, "at least", func(a, b float64) bool { return a >= b })
+		case "max":
+			msg, err = compareField(field, param, "at most", func(a, b float64) bool { return a <= b })
+		case "len":
+			msg, err = compareField(field, param, "exactly", func(a, b float64) bool { return a == b })
+		case "oneof":
+			msg = oneOf(field, strings.Fields(param))
+		case "email":
+			msg = isEmail(field)
+		case "regexp":
+			msg, err = v.matchRegexp(field, param)
+		default:
+			err = fmt.Errorf("unknown validate rule %q", name)
+		}
+
+		if err != nil || msg != "" {
+			return msg, err
+		}
+	}
+
+	return "", nil
+}
+
+func (v *DefaultValidator) matchRegexp(field reflect.Value, pattern string) (string, error) {
+	if field.Kind() != reflect.String {
+		return "", errors.New("regexp only applies to strings")
+	}
+	if field.Len() == 0 {
+		return "", nil
+	}
+
+	re, ok := v.regexps.Load(pattern)
+	if !ok {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		re, _ = v.regexps.LoadOrStore(pattern, compiled)
+	}
+
+	if !re.(*regexp.Regexp).MatchString(field.String()) {
+		return "must match " + pattern, nil
+	}
+	return "", nil
+}
+
+// Compare a number by value, or a string, slice or map by length
+func compareField(field reflect.Value, param string, word string, ok func(a, b float64) bool) (string, error) {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid validate parameter %q", param)
+	}
+
+	var (
+		actual float64
+		prefix string
+	)
+	switch field.Kind() {
+	case reflect.String:
+		actual = float64(len([]rune(field.String())))
+		prefix = "length "
+	case reflect.Slice, reflect.Array, reflect.Map:
+		actual = float64(field.Len())
+		prefix = "length "
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = field.Float()
+	default:
+		return "", fmt.Errorf("cannot compare %s", field.Kind())
+	}
+
+	if !ok(actual, limit) {
+		return fmt.Sprintf("%smust be %s %s", prefix, word, param), nil
+	}
+	return "", nil
+}
+
+func oneOf(field reflect.Value, options []string) string {
+	var value string
+	switch field.Kind() {
+	case reflect.String:
+		value = field.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = strconv.FormatInt(field.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = strconv.FormatUint(field.Uint(), 10)
+	default:
+		return "must be one of [" + strings.Join(options, " ") + "]"
+	}
+
+	for _, o := range options {
+		if o == value {
+			return ""
+		}
+	}
+	return "must be one of [" + strings.Join(options, " ") + "]"
+}
+
+func isEmail(field reflect.Value) string {
+	if field.Kind() != reflect.String {
+		return "must be a valid email address"
+	}
+	if field.Len() == 0 {
+		return ""
+	}
+	if addr, err := mail.ParseAddress(field.String()); err != nil || addr.Address != field.String() {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func hasRule(tag string, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if strings.TrimSpace(r) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Use the json name of the field when it has one
+func fieldName(f reflect.StructField) string {
+	if name := strings.Split(f.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return f.Name
+}
+
+// Error makes it compatible with `error` interface.
+func (ve ValidationErrors) Error() string {
+	fields := make([]string, 0, len(ve))
+	for f := range ve {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	msg := make([]string, 0, len(fields))
+	for _, f := range fields {
+		msg = append(msg, f+" "+ve[f])
+	}
+	return strings.Join(msg, "; ")
+}
+
+// Wrap validation failures into a 422 HTTPError, other errors are returned as is.
+func newValidationError(err error) error {
+	if ve, ok := err.(ValidationErrors); ok {
+		return NewHTTPError(http.StatusUnprocessableEntity).setExtDes(ve)
+	}
+	return err
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type validateAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type validateBase struct {
+	Kind string `json:"kind" validate:"oneof=user admin"`
+}
+
+type validateUser struct {
+	validateBase
+	Name    string            `json:"name" validate:"required,min=2,max=4"`
+	Age     int               `json:"age" validate:"min=18"`
+	Code    string            `json:"code" validate:"len=3,regexp=^[0-9,]+$"`
+	Email   string            `json:"email" validate:"email"`
+	Address validateAddress   `json:"address"`
+	List    []validateAddress `json:"list"`
+	Score   *int              `json:"score" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	v := &DefaultValidator{}
+
+	tests := []struct {
+		name string
+		body string
+		want ValidationErrors
+	}{
+		{
+			name: "valid",
+			body: `{"kind":"admin","name":"abc","age":30,"code":"1,2","email":"a@b.co","address":{"city":"x"},"score":0}`,
+		},
+		{
+			name: "every rule fails",
+			body: `{"kind":"x","name":"abcdef","age":3,"code":"1a","email":"nope","list":[{}]}`,
+			want: ValidationErrors{
+				"kind":         "must be one of [user admin]",
+				"name":         "length must be at most 4",
+				"age":          "must be at least 18",
+				"code":         "length must be exactly 3",
+				"email":        "must be a valid email address",
+				"address.city": "is required",
+				"list[0].city": "is required",
+				"score":        "is required",
+			},
+		},
+		{
+			name: "regexp",
+			body: `{"kind":"user","name":"ab","age":18,"code":"1a2","address":{"city":"x"},"score":1}`,
+			want: ValidationErrors{"code": "must match ^[0-9,]+$"},
+		},
+	}
+
+	for _, tt := range tests {
+		u := &validateUser{}
+		if err := json.Unmarshal([]byte(tt.body), u); err != nil {
+			t.Fatal(err)
+		}
+
+		err := v.Validate(u)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: Validate error = %v", tt.name, err)
+			}
+			continue
+		}
+		var ve ValidationErrors
+		if !errors.As(err, &ve) || !reflect.DeepEqual(ve, tt.want) {
+			t.Errorf("%s: Validate error = %#v, want %#v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidateMalformedTag(t *testing.T) {
+	v := &DefaultValidator{}
+
+	tests := []struct {
+		name string
+		i    interface{}
+	}{
+		{"unknown rule", &struct {
+			A string `validate:"unknown"`
+		}{}},
+		{"invalid parameter", &struct {
+			A int `validate:"min=x"`
+		}{}},
+		{"not a struct", new(int)},
+	}
+
+	for _, tt := range tests {
+		err := v.Validate(tt.i)
+		if _, ok := err.(ValidationErrors); err == nil || ok {
+			t.Errorf("%s: Validate error = %v, want a non validation error", tt.name, err)
+		}
+	}
+}
+
+func TestValidateHTTPErrorHandler(t *testing.T) {
+	eh := NewEasyHandler()
+	eh.POST("/users", func(c Context) error {
+		u := &validateUser{}
+		if err := c.Bind(u); err != nil {
+			return err
+		}
+		if err := c.Validate(u); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	body := `{"kind":"user","name":"a","age":18,"code":"123","address":{"city":"x"},"score":1}`
+	want := ValidationErrors{"name": "length must be at least 2"}
+
+	// Rendered by DefaultHTTPErrorHandler
+	rec := serveBody(eh, POST, "/users", MIMEApplicationJSON, body)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("code = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	var got struct {
+		Message string           `json:"message"`
+		Errors  ValidationErrors `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Message != http.StatusText(http.StatusUnprocessableEntity) || !reflect.DeepEqual(got.Errors, want) {
+		t.Errorf("body = %s", rec.Body)
+	}
+
+	// A custom HTTPErrorHandler gets the field errors in ExtDes
+	var handled error
+	eh.HTTPErrorHandler = func(err error, c Context) {
+		handled = err
+		c.NoContent(http.StatusTeapot)
+	}
+	rec = serveBody(eh, POST, "/users", MIMEApplicationJSON, body)
+	he, ok := handled.(*HTTPError)
+	if !ok || he.Code != http.StatusUnprocessableEntity || !reflect.DeepEqual(he.ExtDes, want) {
+		t.Errorf("HTTPErrorHandler got %#v", handled)
+	}
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("code = %d, want the one of the custom handler", rec.Code)
+	}
+}
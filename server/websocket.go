@@ -0,0 +1,615 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket headers
+const (
+	HeaderSecWebSocketKey      = "Sec-WebSocket-Key"
+	HeaderSecWebSocketAccept   = "Sec-WebSocket-Accept"
+	HeaderSecWebSocketVersion  = "Sec-WebSocket-Version"
+	HeaderSecWebSocketProtocol = "Sec-WebSocket-Protocol"
+)
+
+// WebSocket message types
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// WebSocket close codes, RFC 6455 section 7.4.1
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	// RFC 6455 section 1.3
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// Default Upgrader.MaxMessageSize
+	defaultMaxMessageSize = 64 * 1024
+
+	// Payload limit of control frames
+	maxControlPayloadSize = 125
+
+	// Timeout of writing a control frame
+	controlWriteTimeout = 3 * time.Second
+
+	// Default Upgrader.WriteTimeout
+	defaultWriteTimeout = 10 * time.Second
+
+	continuationFrame = 0
+	finalBit          = 0x80
+	rsvBits           = 0x70
+	opcodeBits        = 0x0f
+	maskBit           = 0x80
+)
+
+var (
+	ErrCloseSent        = errors.New("websocket: close sent")
+	ErrMessageTooBig    = errors.New("websocket: message too big")
+	ErrBadMessageType   = errors.New("websocket: bad message type")
+	ErrControlTooBig    = errors.New("websocket: control frame payload too big")
+	errBadHandshakeConn = errors.New("websocket: response does not implement http.Hijacker")
+)
+
+type (
+	// Upgrader upgrades an HTTP request to a WebSocket connection.
+	Upgrader struct {
+		// Max size of a message, fragmented messages are counted as a whole.
+		// 0 means defaultMaxMessageSize.
+		MaxMessageSize int64
+
+		// Timeout of writing a message, so that a peer which stops reading can
+		// not block the writers. 0 means defaultWriteTimeout.
+		WriteTimeout time.Duration
+
+		// Supported subprotocols in order of preference
+		Subprotocols []string
+
+		// CheckOrigin returns true if the request Origin header is acceptable.
+		// If nil, the Origin must be absent or match the Host header.
+		CheckOrigin func(r *http.Request) bool
+	}
+
+	// WebSocketConn is a server side WebSocket connection. One goroutine may read
+	// and others may write concurrently.
+	WebSocketConn struct {
+		conn        net.Conn
+		br          *bufio.Reader
+		subprotocol string
+
+		maxMessageSize int64
+		writeTimeout   time.Duration
+		pongHandler    func(appData string) error
+
+		// Registry of the EasyHandler which upgraded the connection
+		manager *webSocketManager
+
+		// Writes are serialized because the reader replies to ping and close
+		writeMu   sync.Mutex
+		closeSent bool
+
+		closeOnce sync.Once
+		// Closed when the connection is closed
+		done chan struct{}
+	}
+
+	// CloseError is returned by ReadMessage when the peer sends a close frame
+	// or the connection is closed with a close code.
+	CloseError struct {
+		Code int
+		Text string
+	}
+
+	webSocketManager struct {
+		mu    sync.Mutex
+		conns map[*WebSocketConn]struct{}
+	}
+)
+
+// Upgrade performs the RFC 6455 handshake and takes over the connection.
+// On a bad handshake it returns an *HTTPError which the HandlerFunc can return.
+func (u *Upgrader) Upgrade(c Context) (*WebSocketConn, error) {
+	r := c.Request()
+
+	if r.Method != GET {
+		return nil, NewHTTPError(http.StatusMethodNotAllowed)
+	}
+	if !headerContainsToken(r.Header, HeaderConnection, "upgrade") ||
+		!headerContainsToken(r.Header, HeaderUpgrade, "websocket") {
+		return nil, NewHTTPError(http.StatusBadRequest, "websocket: not a websocket handshake")
+	}
+	if r.Header.Get(HeaderSecWebSocketVersion) != "13" {
+		c.Response().Header().Set(HeaderSecWebSocketVersion, "13")
+		return nil, NewHTTPError(http.StatusUpgradeRequired, "websocket: unsupported version")
+	}
+
+	key := r.Header.Get(HeaderSecWebSocketKey)
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, NewHTTPError(http.StatusBadRequest, "websocket: invalid "+HeaderSecWebSocketKey)
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, NewHTTPError(http.StatusForbidden, "websocket: origin not allowed")
+	}
+
+	subprotocol := u.selectSubprotocol(r)
+
+	if _, ok := c.Response().Writer.(http.Hijacker); !ok {
+		return nil, errBadHandshakeConn
+	}
+	netConn, brw, err := c.Response().Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// The server may have set deadlines for the request, they belong to us now
+	netConn.SetDeadline(time.Time{})
+
+	var buf strings.Builder
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	buf.WriteString(HeaderSecWebSocketAccept + ": " + computeAcceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		buf.WriteString(HeaderSecWebSocketProtocol + ": " + subprotocol + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	netConn.SetWriteDeadline(time.Now().Add(controlWriteTimeout))
+	if _, err = netConn.Write([]byte(buf.String())); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	netConn.SetWriteDeadline(time.Time{})
+
+	// Nothing else may be written by the HTTP layer
+	c.Response().Status = http.StatusSwitchingProtocols
+	c.Response().Committed = true
+
+	maxMessageSize := u.MaxMessageSize
+	if maxMessageSize <= 0 {
+		maxMessageSize = defaultMaxMessageSize
+	}
+
+	writeTimeout := u.WriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = defaultWriteTimeout
+	}
+
+	ws := &WebSocketConn{
+		conn:           netConn,
+		br:             brw.Reader,
+		subprotocol:    subprotocol,
+		maxMessageSize: maxMessageSize,
+		writeTimeout:   writeTimeout,
+		done:           make(chan struct{}),
+	}
+	if eh := c.EasyHandler(); eh != nil {
+		ws.manager = eh.webSockets
+		ws.manager.add(ws)
+	}
+
+	return ws, nil
+}
+
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	requested := headerTokens(r.Header, HeaderSecWebSocketProtocol)
+	for _, s := range u.Subprotocols {
+		for _, rs := range requested {
+			if s == rs {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (ws *WebSocketConn) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// RemoteAddr returns the remote network address.
+func (ws *WebSocketConn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the read deadline on the underlying connection.
+func (ws *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetPongHandler sets the handler called for every pong received by ReadMessage.
+func (ws *WebSocketConn) SetPongHandler(h func(appData string) error) {
+	ws.pongHandler = h
+}
+
+// ReadMessage returns the next data message. Fragmented messages are reassembled,
+// pings are answered and a close frame is answered and returned as *CloseError.
+func (ws *WebSocketConn) ReadMessage() (messageType int, p []byte, err error) {
+	var message []byte
+	messageType = continuationFrame
+
+	for {
+		final, opcode, payload, err := ws.readFrame(ws.maxMessageSize - int64(len(message)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case PingMessage:
+			if err = ws.WriteControl(PongMessage, payload, time.Now().Add(controlWriteTimeout)); err != nil && err != ErrCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			if ws.pongHandler != nil {
+				if err = ws.pongHandler(string(payload)); err != nil {
+					return 0, nil, err
+				}
+			}
+			continue
+		case CloseMessage:
+			return 0, nil, ws.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if messageType != continuationFrame {
+				return 0, nil, ws.fail(CloseProtocolError, "websocket: data frame inside a fragmented message")
+			}
+			messageType = opcode
+		case continuationFrame:
+			if messageType == continuationFrame {
+				return 0, nil, ws.fail(CloseProtocolError, "websocket: continuation frame without a message")
+			}
+		default:
+			return 0, nil, ws.fail(CloseProtocolError, fmt.Sprintf("websocket: unknown opcode %d", opcode))
+		}
+
+		message = append(message, payload...)
+		if final {
+			break
+		}
+	}
+
+	if messageType == TextMessage && !utf8.Valid(message) {
+		return 0, nil, ws.fail(CloseInvalidFramePayloadData, "websocket: invalid utf8 in text message")
+	}
+
+	return messageType, message, nil
+}
+
+// Read one frame, data frames larger than limit fail the connection
+func (ws *WebSocketConn) readFrame(limit int64) (final bool, opcode int, payload []byte, err error) {
+	var header [8]byte
+	if _, err = io.ReadFull(ws.br, header[:2]); err != nil {
+		return false, 0, nil, ws.readError(err)
+	}
+
+	final = header[0]&finalBit != 0
+	opcode = int(header[0] & opcodeBits)
+	masked := header[1]&maskBit != 0
+	length := int64(header[1] & 0x7f)
+
+	if header[0]&rsvBits != 0 {
+		return false, 0, nil, ws.fail(CloseProtocolError, "websocket: reserved bits set without extension")
+	}
+	if !masked {
+		return false, 0, nil, ws.fail(CloseProtocolError, "websocket: client frame is not masked")
+	}
+
+	switch length {
+	case 126:
+		if _, err = io.ReadFull(ws.br, header[:2]); err != nil {
+			return false, 0, nil, ws.readError(err)
+		}
+		length = int64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err = io.ReadFull(ws.br, header[:8]); err != nil {
+			return false, 0, nil, ws.readError(err)
+		}
+		n := binary.BigEndian.Uint64(header[:8])
+		if n>>63 != 0 {
+			return false, 0, nil, ws.fail(CloseProtocolError, "websocket: invalid payload length")
+		}
+		length = int64(n)
+	}
+
+	isControl := opcode >= CloseMessage
+	if isControl {
+		if !final {
+			return false, 0, nil, ws.fail(CloseProtocolError, "websocket: fragmented control frame")
+		}
+		if length > maxControlPayloadSize {
+			return false, 0, nil, ws.fail(CloseProtocolError, ErrControlTooBig.Error())
+		}
+	} else if length > limit {
+		// Reject before allocating the payload
+		ws.fail(CloseMessageTooBig, "")
+		return false, 0, nil, ErrMessageTooBig
+	}
+
+	var maskKey [4]byte
+	if _, err = io.ReadFull(ws.br, maskKey[:]); err != nil {
+		return false, 0, nil, ws.readError(err)
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(ws.br, payload); err != nil {
+		return false, 0, nil, ws.readError(err)
+	}
+	for i := range payload {
+		payload[i] ^= maskKey[i&3]
+	}
+
+	return final, opcode, payload, nil
+}
+
+// Answer a close frame of the peer and close the connection
+func (ws *WebSocketConn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+
+	if len(payload) == 1 {
+		return ws.fail(CloseProtocolError, "websocket: invalid close payload")
+	}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Text = string(payload[2:])
+		if !isValidReceivedCloseCode(closeErr.Code) {
+			return ws.fail(CloseProtocolError, "websocket: invalid close code")
+		}
+		if !utf8.ValidString(closeErr.Text) {
+			return ws.fail(CloseInvalidFramePayloadData, "websocket: invalid utf8 in close reason")
+		}
+	}
+
+	var reply []byte
+	if closeErr.Code != CloseNoStatusReceived {
+		reply = FormatCloseMessage(closeErr.Code, "")
+	}
+	ws.WriteControl(CloseMessage, reply, time.Now().Add(controlWriteTimeout))
+	ws.Close()
+
+	return closeErr
+}
+
+// Send a close frame for a protocol violation and close the connection
+func (ws *WebSocketConn) fail(code int, text string) error {
+	ws.WriteControl(CloseMessage, FormatCloseMessage(code, text), time.Now().Add(controlWriteTimeout))
+	ws.Close()
+	return &CloseError{Code: code, Text: text}
+}
+
+// Reading after the connection was closed on our side is an abnormal closure
+func (ws *WebSocketConn) readError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	select {
+	case <-ws.done:
+		return &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+	default:
+		return err
+	}
+}
+
+// WriteMessage writes a text or binary message as a single frame within
+// Upgrader.WriteTimeout.
+func (ws *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return ErrBadMessageType
+	}
+	return ws.writeFrame(messageType, data, time.Now().Add(ws.writeTimeout))
+}
+
+// WriteControl writes a close, ping or pong frame with the given deadline.
+// After a close frame is written no other frame can be written.
+func (ws *WebSocketConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if messageType != CloseMessage && messageType != PingMessage && messageType != PongMessage {
+		return ErrBadMessageType
+	}
+	if len(data) > maxControlPayloadSize {
+		return ErrControlTooBig
+	}
+	return ws.writeFrame(messageType, data, deadline)
+}
+
+// Ping sends a ping frame, the peer answers with a pong.
+func (ws *WebSocketConn) Ping(data []byte) error {
+	return ws.WriteControl(PingMessage, data, time.Now().Add(controlWriteTimeout))
+}
+
+func (ws *WebSocketConn) writeFrame(opcode int, data []byte, deadline time.Time) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+
+	// Server frames are not masked
+	frame := make([]byte, 0, len(data)+10)
+	frame = append(frame, finalBit|byte(opcode))
+	switch n := len(data); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, data...)
+
+	ws.conn.SetWriteDeadline(deadline)
+	if _, err := ws.conn.Write(frame); err != nil {
+		return err
+	}
+
+	if opcode == CloseMessage {
+		ws.closeSent = true
+	}
+	return nil
+}
+
+// Close closes the underlying connection without sending a close frame.
+// Use WriteControl(CloseMessage, ...) first for a clean close.
+func (ws *WebSocketConn) Close() error {
+	var err error
+	ws.closeOnce.Do(func() {
+		err = ws.conn.Close()
+		if ws.manager != nil {
+			ws.manager.remove(ws)
+		}
+		close(ws.done)
+	})
+	return err
+}
+
+// FormatCloseMessage formats code and text as the payload of a close frame.
+func FormatCloseMessage(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return []byte{}
+	}
+	if len(text) > maxControlPayloadSize-2 {
+		text = text[:maxControlPayloadSize-2]
+	}
+	b := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(b, uint16(code))
+	copy(b[2:], text)
+	return b
+}
+
+// Error makes it compatible with `error` interface.
+func (ce *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", ce.Code, ce.Text)
+}
+
+func (wm *webSocketManager) add(ws *WebSocketConn) {
+	wm.mu.Lock()
+	wm.conns[ws] = struct{}{}
+	wm.mu.Unlock()
+}
+
+func (wm *webSocketManager) remove(ws *WebSocketConn) {
+	wm.mu.Lock()
+	delete(wm.conns, ws)
+	wm.mu.Unlock()
+}
+
+func newWebSocketManager() *webSocketManager {
+	return &webSocketManager{conns: make(map[*WebSocketConn]struct{})}
+}
+
+// Send "going away" to every connection and wait for the handlers to finish the
+// close handshake. Connections still open when ctx is done are closed, which
+// also fails a write blocked on a peer that stopped reading.
+func (wm *webSocketManager) closeAll(ctx context.Context) error {
+	wm.mu.Lock()
+	conns := make([]*WebSocketConn, 0, len(wm.conns))
+	for ws := range wm.conns {
+		conns = append(conns, ws)
+	}
+	wm.mu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(controlWriteTimeout)
+	}
+	msg := FormatCloseMessage(CloseGoingAway, "server shutdown")
+	for _, ws := range conns {
+		// Not waited for, a write in progress holds the lock of the connection
+		go ws.WriteControl(CloseMessage, msg, deadline)
+	}
+
+	var err error
+	for _, ws := range conns {
+		select {
+		case <-ws.done:
+		case <-ctx.Done():
+			ws.Close()
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+func computeAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get(HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func isValidReceivedCloseCode(code int) bool {
+	switch code {
+	case CloseNormalClosure, CloseGoingAway, CloseProtocolError, CloseUnsupportedData,
+		CloseInvalidFramePayloadData, ClosePolicyViolation, CloseMessageTooBig,
+		CloseMandatoryExtension, CloseInternalServerErr:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
+
+// Comma separated values of the header
+func headerTokens(header http.Header, name string) []string {
+	var tokens []string
+	for _, v := range header[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
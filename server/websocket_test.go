@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// A connection registered to wm whose peer never reads
+func newStalledWebSocket(t *testing.T, wm *webSocketManager, writeTimeout time.Duration) *WebSocketConn {
+	t.Helper()
+
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	ws := &WebSocketConn{
+		conn:         server,
+		writeTimeout: writeTimeout,
+		manager:      wm,
+		done:         make(chan struct{}),
+	}
+	wm.add(ws)
+	t.Cleanup(func() { ws.Close() })
+
+	return ws
+}
+
+func TestWebSocketWriteTimeout(t *testing.T) {
+	ws := newStalledWebSocket(t, newWebSocketManager(), 20*time.Millisecond)
+
+	start := time.Now()
+	err := ws.WriteMessage(TextMessage, []byte("hello"))
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("WriteMessage error = %v, want a deadline error", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("WriteMessage took %s", took)
+	}
+}
+
+func TestWebSocketCloseAllBlockedWriter(t *testing.T) {
+	wm := newWebSocketManager()
+	ws := newStalledWebSocket(t, wm, time.Hour)
+
+	writeErr := make(chan error, 1)
+	go func() {
+		writeErr <- ws.WriteMessage(TextMessage, []byte("hello"))
+	}()
+	// Let the writer take the lock
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := wm.closeAll(ctx); err != context.DeadlineExceeded {
+		t.Errorf("closeAll error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("closeAll took %s, want about the timeout of ctx", took)
+	}
+
+	select {
+	case err := <-writeErr:
+		if err == nil {
+			t.Error("blocked WriteMessage succeeded after closeAll")
+		}
+	case <-time.After(time.Second):
+		t.Error("blocked WriteMessage was not released by closeAll")
+	}
+}
+
+func TestWebSocketManagerPerHandler(t *testing.T) {
+	eh1, eh2 := NewEasyHandler(), NewEasyHandler()
+	ws := newStalledWebSocket(t, eh1.webSockets, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := eh2.webSockets.closeAll(ctx); err != nil {
+		t.Errorf("closeAll of another handler error = %v", err)
+	}
+
+	select {
+	case <-ws.done:
+		t.Error("connection closed by another handler")
+	default:
+	}
+}